@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/cmd"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
 
 var version = "0.1.14"
@@ -29,8 +31,26 @@ applications with automatic port allocation and nginx configuration.`,
 	rootCmd.AddCommand(cmd.NewCleanupCmd())
 	rootCmd.AddCommand(cmd.NewBootstrapRemoteCmd())
 	rootCmd.AddCommand(cmd.NewHooksCmd())
+	rootCmd.AddCommand(cmd.NewCheckoutCmd())
+	rootCmd.AddCommand(cmd.NewDaemonCmd())
+	rootCmd.AddCommand(cmd.NewInstallServiceCmd())
+	rootCmd.AddCommand(cmd.NewProxyCmd())
+	rootCmd.AddCommand(cmd.NewExecCmd())
+	rootCmd.AddCommand(cmd.NewShellCmd())
+	rootCmd.AddCommand(cmd.NewTunnelCmd())
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+
+	// Close any SSH connections shared across the command
+	ssh.CloseAll()
+
+	// Commands run with exec and shell pass on their exit status
+	var exitErr *cmd.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/thatjpcsguy/protohost/internal/git"
+)
+
+// NewCheckoutCmd creates the checkout command
+func NewCheckoutCmd() *cobra.Command {
+	var opts git.CheckoutOptions
+
+	cmd := &cobra.Command{
+		Use:    "checkout",
+		Short:  "Check out a branch or ref using the repository cache",
+		Long:   `Checks out a branch or ref into a directory as a worktree of a cached mirror in ~/.protohost/cache. Used by remote deploys.`,
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.RepoURL == "" || opts.TargetDir == "" {
+				return fmt.Errorf("--repo and --dir are required")
+			}
+			if opts.Branch == "" && opts.Ref == "" {
+				return fmt.Errorf("one of --branch or --ref is required")
+			}
+
+			_, err := git.Checkout(opts)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.RepoURL, "repo", "", "Repository URL")
+	cmd.Flags().StringVar(&opts.TargetDir, "dir", "", "Directory to check out into")
+	cmd.Flags().StringVar(&opts.Branch, "branch", "", "Branch to check out")
+	cmd.Flags().StringVar(&opts.Ref, "ref", "", "Commit, tag or ref to check out instead of a branch")
+	cmd.Flags().IntVar(&opts.Depth, "depth", 0, "Fetch depth (0 for full history)")
+
+	return cmd
+}
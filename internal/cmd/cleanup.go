@@ -9,7 +9,14 @@ import (
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/deploylog"
 	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/events"
+	"github.com/thatjpcsguy/protohost/internal/forge"
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/hooks"
+	"github.com/thatjpcsguy/protohost/internal/nginx"
+	"github.com/thatjpcsguy/protohost/internal/notify"
 	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
@@ -20,52 +27,112 @@ func NewCleanupCmd() *cobra.Command {
 		remote bool
 		local  bool
 		dryRun bool
+		merged bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "cleanup",
 		Short: "Remove expired deployments",
-		Long:  `Removes remote expired deployments by default. Use --local to cleanup local deployments.`,
+		Long: `Removes remote expired deployments by default. Use --local to cleanup local deployments.
+
+With --merged, also removes deployments whose branch no longer exists in the
+repository (e.g. deleted after merging).`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Default to remote unless --local is specified
 			if local {
-				return cleanupLocal(dryRun)
+				return cleanupLocal(dryRun, merged)
 			}
-			return cleanupRemote(dryRun)
+			return cleanupRemote(dryRun, merged)
 		},
 	}
 
 	cmd.Flags().BoolVar(&remote, "remote", false, "Cleanup remote deployments (default, kept for backwards compatibility)")
 	cmd.Flags().BoolVar(&local, "local", false, "Cleanup local deployments instead of remote")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be removed")
+	cmd.Flags().BoolVar(&merged, "merged", false, "Also remove deployments whose branch was deleted from the repository")
 
 	return cmd
 }
 
-func cleanupLocal(dryRun bool) error {
+func cleanupLocal(dryRun, merged bool) error {
 	reg, err := registry.New()
 	if err != nil {
 		return fmt.Errorf("failed to open registry: %w", err)
 	}
 	defer func() { _ = reg.Close() }()
 
+	// Notification settings are host-wide, so they come from the global config
+	globalCfg, err := config.LoadGlobal()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	notifier := notify.New(globalCfg)
+
+	// Warn owners before their deployments expire
+	if notifier != nil && !dryRun {
+		warnExpiring(reg, notifier, globalCfg.ExpiryWarningHours)
+	}
+
+	// Prune old deploy logs, including those of deployments removed before
+	if !dryRun && globalCfg != nil {
+		if pruned, err := deploylog.Prune(globalCfg.LogRetentionDays); err != nil {
+			fmt.Printf("Warning: failed to prune deploy logs: %v\n", err)
+		} else if pruned > 0 {
+			fmt.Printf("🧹 Pruned %d deploy log(s) older than %d days\n", pruned, globalCfg.LogRetentionDays)
+		}
+	}
+
 	// Mark expired deployments
 	expired, err := reg.MarkExpired()
 	if err != nil {
 		return fmt.Errorf("failed to mark expired: %w", err)
 	}
 
-	if len(expired) == 0 {
-		fmt.Println("No expired deployments found")
-		return nil
-	}
-
 	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	var toRemove []registry.PortAllocation
+	var reasons []string
+	var labels []string
 
-	fmt.Println("Found expired deployments:")
 	for _, alloc := range expired {
 		daysAgo := int(time.Since(alloc.ExpiresAt).Hours() / 24)
-		fmt.Printf("  - %s %s\n", alloc.ProjectName, red(fmt.Sprintf("(expired %d days ago)", daysAgo)))
+		reason := fmt.Sprintf("expired %d days ago", daysAgo)
+		toRemove = append(toRemove, alloc)
+		reasons = append(reasons, reason)
+		labels = append(labels, red("("+reason+")"))
+	}
+
+	if merged {
+		deleted, unseen, err := findDeletedBranches(reg, expired, !dryRun)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			for _, alloc := range unseen {
+				fmt.Printf("Skipping %s: branch %s was never seen in the repository\n", alloc.ProjectName, alloc.Branch)
+			}
+		}
+		for _, alloc := range deleted {
+			reason := fmt.Sprintf("branch %s deleted", alloc.Branch)
+			toRemove = append(toRemove, alloc)
+			reasons = append(reasons, reason)
+			labels = append(labels, yellow("("+reason+")"))
+		}
+	}
+
+	if len(toRemove) == 0 {
+		if merged {
+			fmt.Println("No expired or merged deployments found")
+		} else {
+			fmt.Println("No expired deployments found")
+		}
+		return nil
+	}
+
+	fmt.Println("Found deployments to remove:")
+	for i, alloc := range toRemove {
+		fmt.Printf("  - %s %s\n", alloc.ProjectName, labels[i])
 	}
 	fmt.Println()
 
@@ -74,16 +141,61 @@ func cleanupLocal(dryRun bool) error {
 		return nil
 	}
 
-	// Clean up each expired deployment
+	// Clean up each deployment
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	for _, alloc := range expired {
+	removed := 0
+	for i, alloc := range toRemove {
 		fmt.Printf("Removing %s...\n", alloc.ProjectName)
 
-		deployDir := filepath.Join(home, ".protohost", "deployments", alloc.ProjectName)
+		// Deployments recorded before the directory was stored always used
+		// the managed deployments directory
+		deployDir := alloc.DeployDir
+		managed := alloc.ManagedDir
+		if deployDir == "" {
+			deployDir = filepath.Join(home, ".protohost", "deployments", alloc.ProjectName)
+			managed = true
+		}
+
+		// Use the deployment's own config for nginx and webhooks, falling
+		// back to the global config if its directory is gone
+		cfg, cfgErr := config.LoadDir(deployDir)
+		if cfgErr != nil {
+			cfg = globalCfg
+		}
+
+		// A failing pre-cleanup hook (e.g. a database dump) keeps the
+		// deployment, so the next cleanup tries again
+		if fileExists(deployDir) {
+			hookCtx := hooks.ContextFor(alloc)
+			hookCtx.DeployDir = deployDir
+			hookEnv := hooks.Env(cfg, hookCtx)
+			hookEnv["CLEANUP_REASON"] = reasons[i]
+			if err := hooks.Execute(hooks.PreCleanup, cfg, deployDir, hookEnv); err != nil {
+				fmt.Printf("  Warning: skipping %s: %v\n", alloc.ProjectName, err)
+				fmt.Println()
+				continue
+			}
+		}
+
+		// Remove nginx configuration
+		if cfgErr == nil && cfg.NginxServer != "" {
+			if err := nginx.Remove(cfg, alloc.ProjectName); err != nil {
+				fmt.Printf("  Warning: failed to remove nginx config: %v\n", err)
+			} else {
+				fmt.Println("  ✓ Removed nginx configuration")
+			}
+		}
+
+		// Keep the containers' last logs in the deploy log
+		if cfg != nil {
+			if err := deploylog.SaveContainerLogs(alloc.ProjectName, cfg.LogTailLines); err != nil {
+				fmt.Printf("  Warning: failed to save container logs: %v\n", err)
+			}
+		}
 
 		// Stop containers
 		if err := docker.Down(alloc.ProjectName, deployDir, true); err != nil {
@@ -92,8 +204,10 @@ func cleanupLocal(dryRun bool) error {
 			fmt.Println("  ✓ Stopped containers")
 		}
 
-		// Remove directory
-		if err := os.RemoveAll(deployDir); err != nil {
+		// Remove directory, but never one protohost didn't create
+		if !managed {
+			fmt.Printf("  Left directory in place: %s\n", deployDir)
+		} else if err := os.RemoveAll(deployDir); err != nil {
 			fmt.Printf("  Warning: failed to remove directory: %v\n", err)
 		} else {
 			fmt.Println("  ✓ Removed directory")
@@ -106,31 +220,142 @@ func cleanupLocal(dryRun bool) error {
 			fmt.Printf("  ✓ Released port %d\n", alloc.WebPort)
 		}
 
+		events.New(cfg).Emit(events.Event{
+			Type:    events.CleanupRemoved,
+			Project: alloc.ProjectName,
+			Branch:  alloc.Branch,
+			Ref:     alloc.Ref,
+			Commit:  alloc.Commit,
+			WebPort: alloc.WebPort,
+			Reason:  reasons[i],
+		})
+
+		// Mark the preview inactive on the git forge, if this host has a token
+		repoURL := alloc.RepoURL
+		if repoURL == "" && cfg != nil {
+			repoURL = cfg.RepoURL
+		}
+		if forgeClient, err := forge.New(cfg, repoURL); err != nil {
+			fmt.Printf("  Warning: forge integration disabled: %v\n", err)
+		} else if err := forgeClient.Inactive(alloc.Commit, alloc.ProjectName); err != nil {
+			fmt.Printf("  Warning: %v\n", err)
+		}
+
+		if notifier != nil {
+			if err := notifier.Removed(alloc, reasons[i]); err != nil {
+				fmt.Printf("  Warning: %v\n", err)
+			} else {
+				fmt.Println("  ✓ Sent removal notification")
+			}
+		}
+
+		removed++
 		fmt.Println()
 	}
 
-	fmt.Printf("✅ Cleanup complete! Removed %d deployment(s)\n", len(expired))
+	fmt.Printf("✅ Cleanup complete! Removed %d deployment(s)\n", removed)
 	return nil
 }
 
-func cleanupRemote(dryRun bool) error {
+// warnExpiring sends a warning for each deployment expiring within the
+// configured window, once per expiry time
+func warnExpiring(reg *registry.Registry, notifier *notify.Notifier, hours int) {
+	if hours <= 0 {
+		return
+	}
+
+	expiring, err := reg.ExpiringWithin(time.Duration(hours) * time.Hour)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return
+	}
+
+	for _, alloc := range expiring {
+		if err := notifier.ExpiryWarning(alloc); err != nil {
+			fmt.Printf("Warning: failed to warn about %s: %v\n", alloc.ProjectName, err)
+			continue
+		}
+		if err := reg.MarkExpiryWarned(alloc.ProjectName); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			continue
+		}
+		fmt.Printf("📣 Sent expiry warning for %s (expires %s)\n",
+			alloc.ProjectName, alloc.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// findDeletedBranches returns branch deployments (excluding those in skip)
+// whose branch no longer exists in their repository, and those whose branch
+// isn't there but never was (e.g. deployed with --sync before being pushed),
+// which are left alone. Branches found in the repository are recorded as
+// seen if record is set. Repositories that can't be reached are skipped
+// rather than treated as empty.
+func findDeletedBranches(reg *registry.Registry, skip []registry.PortAllocation, record bool) (deleted, unseen []registry.PortAllocation, err error) {
+	allocations, err := reg.ListAllocations()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list allocations: %w", err)
+	}
+
+	skipped := make(map[string]bool)
+	for _, alloc := range skip {
+		skipped[alloc.ProjectName] = true
+	}
+
+	branchesByRepo := make(map[string]map[string]bool)
+
+	for _, alloc := range allocations {
+		// Ref and PR deployments aren't tied to a branch
+		if skipped[alloc.ProjectName] || alloc.Ref != "" || alloc.RepoURL == "" {
+			continue
+		}
+
+		branches, ok := branchesByRepo[alloc.RepoURL]
+		if !ok {
+			branches, err = git.RemoteBranches(alloc.RepoURL)
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			branchesByRepo[alloc.RepoURL] = branches
+		}
+
+		switch {
+		case branches == nil:
+		case branches[alloc.Branch]:
+			if record && !alloc.SeenOnRemote {
+				if err := reg.MarkSeenOnRemote(alloc.ProjectName); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+		case alloc.SeenOnRemote:
+			deleted = append(deleted, alloc)
+		default:
+			unseen = append(unseen, alloc)
+		}
+	}
+
+	return deleted, unseen, nil
+}
+
+func cleanupRemote(dryRun, merged bool) error {
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
-	dryRunFlag := ""
+	flags := ""
 	if dryRun {
-		dryRunFlag = "--dry-run"
+		flags += " --dry-run"
+	}
+	if merged {
+		flags += " --merged"
 	}
 
 	// Use --local to avoid recursive remote execution
-	cmd := fmt.Sprintf("cd %s && protohost cleanup --local %s", cfg.RemoteBaseDir, dryRunFlag)
+	cmd := fmt.Sprintf("cd %s && %sprotohost cleanup --local%s", ssh.QuotePath(cfg.RemoteBaseDir), hooks.RemoteUserPrefix(), flags)
 	return client.ExecuteInteractive(cmd)
 }
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/deploylog"
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/events"
+	"github.com/thatjpcsguy/protohost/internal/nginx"
+	"github.com/thatjpcsguy/protohost/internal/proxy"
+	"github.com/thatjpcsguy/protohost/internal/registry"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
+)
+
+// NewDaemonCmd creates the daemon command
+func NewDaemonCmd() *cobra.Command {
+	var (
+		interval time.Duration
+		once     bool
+		merged   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Periodically clean up and reconcile deployments on this host",
+		Long: `Runs maintenance for the deployments on this host every --interval:
+
+  1. Removes expired deployments (and, with --merged, deleted branches)
+  2. Reconciles registry status with the containers actually running
+  3. Refreshes nginx configuration for running deployments
+  4. Saves the last container logs of running deployments to their deploy logs
+  5. Stops deployments with no requests for IDLE_STOP_HOURS (with PROXY_PORT)
+
+Use --once to run a single pass, e.g. from a systemd timer installed with
+'protohost install-service'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if once {
+				return runMaintenance(merged)
+			}
+			return runDaemon(interval, merged)
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 15*time.Minute, "Time between maintenance passes")
+	cmd.Flags().BoolVar(&once, "once", false, "Run a single maintenance pass and exit")
+	cmd.Flags().BoolVar(&merged, "merged", false, "Also remove deployments whose branch was deleted from the repository")
+
+	return cmd
+}
+
+// runDaemon runs maintenance passes until interrupted. Failed passes are
+// reported and retried on the next tick rather than stopping the daemon.
+func runDaemon(interval time.Duration, merged bool) error {
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("🕒 Running maintenance every %s (Ctrl+C to stop)\n", interval)
+
+	for {
+		if err := runMaintenance(merged); err != nil {
+			fmt.Printf("Warning: maintenance failed: %v\n", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			fmt.Println("Stopping daemon")
+			return nil
+		}
+	}
+}
+
+// runMaintenance runs a single cleanup, reconcile and nginx refresh pass
+func runMaintenance(merged bool) error {
+	fmt.Printf("\n[%s] Running maintenance\n", time.Now().Format(time.RFC3339))
+
+	// Don't hold connections to nginx servers open between passes
+	defer ssh.CloseAll()
+
+	if err := cleanupLocal(false, merged); err != nil {
+		return fmt.Errorf("cleanup failed: %w", err)
+	}
+
+	reg, err := registry.New()
+	if err != nil {
+		return fmt.Errorf("failed to open registry: %w", err)
+	}
+	defer func() { _ = reg.Close() }()
+
+	allocations, err := reg.ListAllocations()
+	if err != nil {
+		return fmt.Errorf("failed to list allocations: %w", err)
+	}
+
+	for _, alloc := range allocations {
+		if err := reconcileAllocation(reg, alloc); err != nil {
+			fmt.Printf("Warning: failed to reconcile %s: %v\n", alloc.ProjectName, err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileAllocation brings the registry in line with docker for one
+// deployment, and refreshes its nginx configuration and saved container
+// logs if it's running
+func reconcileAllocation(reg *registry.Registry, alloc registry.PortAllocation) error {
+	running, err := docker.IsRunning(alloc.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	// A deployment whose directory is gone and has no containers can't be
+	// brought back, so release its port
+	if !running && alloc.DeployDir != "" && !fileExists(alloc.DeployDir) {
+		if err := reg.ReleasePort(alloc.ProjectName); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Released port %d of %s (directory %s no longer exists)\n",
+			alloc.WebPort, alloc.ProjectName, alloc.DeployDir)
+		return nil
+	}
+
+	// Deployments without a recorded directory only get the global config.
+	// Status is reconciled even if the config can't be loaded.
+	var cfg *config.Config
+	var cfgErr error
+	if alloc.DeployDir != "" {
+		cfg, cfgErr = config.LoadDir(alloc.DeployDir)
+	} else {
+		cfg, cfgErr = config.LoadGlobal()
+	}
+
+	health := events.Event{
+		Type:    events.Health,
+		Project: alloc.ProjectName,
+		Branch:  alloc.Branch,
+		Ref:     alloc.Ref,
+		Commit:  alloc.Commit,
+		WebPort: alloc.WebPort,
+	}
+
+	switch {
+	case running && alloc.Status != "running":
+		if err := reg.UpdateStatus(alloc.ProjectName, "running"); err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s is running, marked as running\n", alloc.ProjectName)
+		health.Status = "running"
+		events.New(cfg).Emit(health)
+	case !running && alloc.Status == "running":
+		if err := reg.UpdateStatus(alloc.ProjectName, "stopped"); err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s has no running containers, marked as stopped\n", alloc.ProjectName)
+		health.Status = "not running"
+		events.New(cfg).Emit(health)
+	}
+
+	if !running || alloc.DeployDir == "" {
+		return nil
+	}
+	if cfgErr != nil {
+		return fmt.Errorf("failed to load config: %w", cfgErr)
+	}
+
+	// Stop deployments nobody has requested for a while; the proxy starts
+	// them again on the next request, so only if it's up
+	if cfg.ProxyPort > 0 && cfg.IdleStopHours > 0 {
+		if idle := time.Since(alloc.LastActiveAt); idle > time.Duration(cfg.IdleStopHours)*time.Hour {
+			addr, err := proxy.Addr(cfg.NginxProxyHost, cfg.ProxyPort)
+			if err == nil {
+				err = proxy.Healthy(addr)
+			}
+			if err == nil {
+				return stopIdle(reg, cfg, alloc, idle)
+			}
+			fmt.Printf("Warning: not stopping idle %s, nothing could wake it: %v\n", alloc.ProjectName, err)
+		}
+	}
+
+	// Keep a rolling window of container logs, for post-mortems after the
+	// containers are recreated
+	if err := deploylog.SaveContainerLogs(alloc.ProjectName, cfg.LogTailLines); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	updated, err := nginx.Refresh(cfg, alloc.ProjectName, nginx.GenerateConfig(cfg, alloc.ProjectName, alloc.WebPort))
+	if err != nil {
+		return err
+	}
+	if updated {
+		fmt.Printf("✓ Refreshed nginx configuration for %s\n", alloc.ProjectName)
+	}
+
+	return nil
+}
+
+// stopIdle stops an idle deployment's containers, keeping them so it can be
+// woken quickly
+func stopIdle(reg *registry.Registry, cfg *config.Config, alloc registry.PortAllocation, idle time.Duration) error {
+	if err := docker.Stop(alloc.ProjectName, alloc.DeployDir); err != nil {
+		return err
+	}
+	if err := reg.UpdateStatus(alloc.ProjectName, "idle"); err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("no requests for %d hours", int(idle.Hours()))
+	fmt.Printf("💤 Stopped %s (%s)\n", alloc.ProjectName, reason)
+
+	events.New(cfg).Emit(events.Event{
+		Type:    events.Health,
+		Project: alloc.ProjectName,
+		Branch:  alloc.Branch,
+		Ref:     alloc.Ref,
+		Commit:  alloc.Commit,
+		WebPort: alloc.WebPort,
+		Status:  "idle",
+		Reason:  reason,
+	})
+
+	return nil
+}
+
+// fileExists checks if a file or directory exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/deploy"
 )
@@ -14,6 +16,15 @@ func NewDeployCmd() *cobra.Command {
 		build         bool
 		branch        string
 		autoBootstrap bool
+		sync          bool
+		buildLocal    bool
+		inPlace       bool
+		skipBuild     bool
+		ref           string
+		pr            int
+		commit        string
+		depth         int
+		managed       bool
 	)
 
 	cmd := &cobra.Command{
@@ -21,6 +32,10 @@ func NewDeployCmd() *cobra.Command {
 		Short: "Deploy current branch",
 		Long:  `Deploys the current branch to remote server by default. Use --local to deploy locally.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if branch != "" && (ref != "" || pr != 0) {
+				return fmt.Errorf("--branch cannot be combined with --ref or --pr")
+			}
+
 			// Default to remote unless --local is specified
 			runRemote := !local
 
@@ -30,13 +45,25 @@ func NewDeployCmd() *cobra.Command {
 					Clean:         clean,
 					Build:         build,
 					AutoBootstrap: autoBootstrap,
+					Sync:          sync,
+					BuildLocal:    buildLocal,
+					Ref:           ref,
+					PR:            pr,
+					Depth:         depth,
 				})
 			}
 
 			return deploy.Local(deploy.LocalOptions{
-				Branch: branch,
-				Clean:  clean,
-				Build:  build,
+				Branch:    branch,
+				Clean:     clean,
+				Build:     build,
+				InPlace:   inPlace,
+				SkipBuild: skipBuild,
+				Ref:       ref,
+				PR:        pr,
+				Commit:    commit,
+				Depth:     depth,
+				Managed:   managed,
 			})
 		},
 	}
@@ -47,6 +74,18 @@ func NewDeployCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&build, "build", false, "Force rebuild containers")
 	cmd.Flags().StringVar(&branch, "branch", "", "Override branch name")
 	cmd.Flags().BoolVar(&autoBootstrap, "auto-bootstrap", false, "Automatically install protohost on remote if missing")
+	cmd.Flags().BoolVar(&sync, "sync", false, "Upload the local working tree to remote instead of deploying from git")
+	cmd.Flags().BoolVar(&buildLocal, "build-local", false, "Build images locally and ship them to remote instead of building there")
+	cmd.Flags().BoolVar(&skipBuild, "skip-build", false, "Don't build images, use those already loaded into docker")
+	cmd.Flags().StringVar(&ref, "ref", "", "Deploy a specific commit SHA or tag instead of a branch")
+	cmd.Flags().IntVar(&pr, "pr", 0, "Deploy a pull request by number (fetches PR_REF_PATTERN)")
+	cmd.Flags().IntVar(&depth, "depth", 0, "Shallow clone depth for the deployment checkout (overrides GIT_DEPTH)")
+	cmd.Flags().BoolVar(&inPlace, "in-place", false, "Deploy from the current directory even if it isn't a git checkout")
+	cmd.Flags().StringVar(&commit, "commit", "", "Commit to record for a deployment that isn't a git checkout")
+	cmd.Flags().BoolVar(&managed, "managed", false, "The deploy directory was created by protohost and is removed on cleanup")
+	_ = cmd.Flags().MarkHidden("in-place")
+	_ = cmd.Flags().MarkHidden("commit")
+	_ = cmd.Flags().MarkHidden("managed")
 
 	return cmd
 }
@@ -3,11 +3,17 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/deploylog"
 	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/events"
+	"github.com/thatjpcsguy/protohost/internal/forge"
 	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/hooks"
 	"github.com/thatjpcsguy/protohost/internal/nginx"
 	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
@@ -47,7 +53,7 @@ func NewDownCmd() *cobra.Command {
 				return downLocal(projectName, removeVolumes)
 			}
 
-			return downRemote(cfg, projectName, removeVolumes)
+			return downRemote(cfg, projectName, branch, removeVolumes)
 		},
 	}
 
@@ -60,30 +66,27 @@ func NewDownCmd() *cobra.Command {
 }
 
 func downLocal(projectName string, removeVolumes bool) error {
-	// Determine deployment directory (same logic as deploy)
-	var deployDir string
-	if git.IsGitRepo() {
-		// Use current directory if in a git repo
-		cwd, err := os.Getwd()
-		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
-		}
-		deployDir = cwd
-	} else {
-		// Otherwise use deployments directory
-		home, err := getUserHomeDir()
-		if err != nil {
-			return err
-		}
-		deployDir = fmt.Sprintf("%s/.protohost/deployments/%s", home, projectName)
+	deployDir, err := resolveDeployDir(projectName)
+	if err != nil {
+		return err
 	}
 
-	// Load config for nginx removal
+	// Load config for hooks and nginx removal
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Printf("Warning: failed to load config: %v\n", err)
 	}
 
+	hookCtx := hookContext(projectName, "")
+	hookCtx.DeployDir = deployDir
+	hookEnv := hooks.Env(cfg, hookCtx)
+	if removeVolumes {
+		hookEnv["REMOVE_VOLUMES"] = "1"
+	}
+	if err := hooks.Execute(hooks.PreDown, cfg, deployDir, hookEnv); err != nil {
+		return err
+	}
+
 	// Remove nginx configuration
 	if cfg != nil && cfg.NginxServer != "" {
 		fmt.Println("🌐 Removing nginx configuration...")
@@ -92,17 +95,34 @@ func downLocal(projectName string, removeVolumes bool) error {
 		}
 	}
 
+	// Keep the containers' last logs in the deploy log
+	if cfg != nil {
+		if err := deploylog.SaveContainerLogs(projectName, cfg.LogTailLines); err != nil {
+			fmt.Printf("Warning: failed to save container logs: %v\n", err)
+		}
+	}
+
 	// Stop containers
 	if err := docker.Down(projectName, deployDir, removeVolumes); err != nil {
 		return err
 	}
 
+	event := events.Event{Type: events.Down, Project: projectName}
+	if removeVolumes {
+		event.Reason = "volumes removed"
+	}
+
 	// Update registry
+	var repoURL string
 	reg, err := registry.New()
 	if err != nil {
 		fmt.Printf("Warning: failed to update registry: %v\n", err)
 	} else {
 		defer func() { _ = reg.Close() }()
+		if alloc, err := reg.GetAllocation(projectName); err == nil {
+			event.Branch, event.Ref, event.Commit, event.WebPort = alloc.Branch, alloc.Ref, alloc.Commit, alloc.WebPort
+			repoURL = alloc.RepoURL
+		}
 		if removeVolumes {
 			// If volumes are removed, delete the registry entry so next deploy runs first-install
 			if err := reg.ReleasePort(projectName); err != nil {
@@ -116,27 +136,91 @@ func downLocal(projectName string, removeVolumes bool) error {
 		}
 	}
 
+	events.New(cfg).Emit(event)
+
+	// Mark the preview inactive on the git forge, if this host has a token
+	if repoURL == "" && cfg != nil {
+		repoURL = cfg.RepoURL
+	}
+	if forgeClient, err := forge.New(cfg, repoURL); err != nil {
+		fmt.Printf("Warning: forge integration disabled: %v\n", err)
+	} else if err := forgeClient.Inactive(event.Commit, projectName); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	if err := hooks.Execute(hooks.PostDown, cfg, deployDir, hookEnv); err != nil {
+		return err
+	}
+
 	fmt.Println("✅ Deployment stopped")
 	return nil
 }
 
-func downRemote(cfg *config.Config, projectName string, removeVolumes bool) error {
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+func downRemote(cfg *config.Config, projectName, branch string, removeVolumes bool) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	volumeFlag := ""
 	if removeVolumes {
 		volumeFlag = "-v"
 	}
 
+	forgeClient, err := forge.New(cfg, cfg.RepoURL)
+	if err != nil {
+		fmt.Printf("Warning: forge integration disabled: %v\n", err)
+	}
+
+	// Note the deployed commit before the deployment goes away
+	var commit string
+	if forgeClient != nil {
+		output, _ := client.Execute(fmt.Sprintf("cd %s && git rev-parse HEAD", ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName)))
+		commit = strings.TrimSpace(output)
+	}
+
 	// Use --local to avoid recursive remote execution
-	cmd := fmt.Sprintf("cd %s/%s && protohost down --local %s",
-		cfg.RemoteBaseDir, projectName, volumeFlag)
+	cmd := fmt.Sprintf("cd %s && %sprotohost down --local --branch %s %s",
+		ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName), hooks.RemoteUserPrefix(), ssh.Quote(branch), volumeFlag)
 
-	return client.ExecuteInteractive(cmd)
+	if err := client.ExecuteInteractive(cmd); err != nil {
+		return err
+	}
+
+	if err := forgeClient.Inactive(commit, projectName); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	return nil
+}
+
+// resolveDeployDir returns the directory a local deployment runs from, as
+// recorded in the registry. Deployments recorded before the directory was
+// stored fall back to the same logic as deploy.
+func resolveDeployDir(projectName string) (string, error) {
+	if reg, err := registry.New(); err == nil {
+		alloc, err := reg.GetAllocation(projectName)
+		_ = reg.Close()
+		if err == nil && alloc.DeployDir != "" {
+			return alloc.DeployDir, nil
+		}
+	}
+
+	if git.IsGitRepo() {
+		// Use current directory if in a git repo
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+		return cwd, nil
+	}
+
+	// Otherwise use deployments directory
+	home, err := getUserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".protohost", "deployments", projectName), nil
 }
 
 func getUserHomeDir() (string, error) {
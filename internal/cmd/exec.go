@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
+	"golang.org/x/term"
+)
+
+// shellCommand starts bash if the container has it, otherwise sh
+var shellCommand = []string{"sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+
+// ExitError reports that a command run in a deployment exited with a
+// non-zero status, which protohost then exits with too
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+// NewExecCmd creates the exec command
+func NewExecCmd() *cobra.Command {
+	var (
+		local   bool
+		branch  string
+		service string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "exec [flags] -- <command> [args...]",
+		Short: "Run a command in a deployment's container",
+		Long: `Runs a command in a service container of the deployment, on the remote
+server by default. Use --local to run it in the local deployment instead.
+
+The command is attached to your terminal, so interactive programs work.
+
+Examples:
+  protohost exec -- python manage.py migrate
+  protohost exec --service db -- psql -U app
+  protohost exec --local --branch feature-x -- ls -la`,
+		Args:          cobra.MinimumNArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExec(local, branch, service, args)
+		},
+	}
+
+	// Everything after the first argument belongs to the command
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().BoolVar(&local, "local", false, "Run in the local deployment instead of remote")
+	cmd.Flags().StringVar(&branch, "branch", "", "Branch name (defaults to current)")
+	cmd.Flags().StringVarP(&service, "service", "s", "web", "Compose service to run the command in")
+
+	return cmd
+}
+
+// NewShellCmd creates the shell command
+func NewShellCmd() *cobra.Command {
+	var (
+		local   bool
+		branch  string
+		service string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Open a shell in a deployment's container",
+		Long: `Opens an interactive shell (bash if available, otherwise sh) in a service
+container of the deployment, on the remote server by default. Use --local
+for the local deployment.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExec(local, branch, service, shellCommand)
+		},
+	}
+
+	cmd.Flags().BoolVar(&local, "local", false, "Open the shell in the local deployment instead of remote")
+	cmd.Flags().StringVar(&branch, "branch", "", "Branch name (defaults to current)")
+	cmd.Flags().StringVarP(&service, "service", "s", "web", "Compose service to open the shell in")
+
+	return cmd
+}
+
+func runExec(local bool, branch, service string, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Detect branch if not specified
+	if branch == "" {
+		branch, err = git.GetCurrentBranch()
+		if err != nil {
+			return fmt.Errorf("failed to detect branch: %w", err)
+		}
+	}
+
+	projectName := fmt.Sprintf("%s-%s", cfg.ProjectPrefix, branch)
+
+	if local {
+		return execLocal(projectName, service, args)
+	}
+
+	return execRemote(cfg, projectName, branch, service, args)
+}
+
+func execLocal(projectName, service string, args []string) error {
+	deployDir, err := resolveDeployDir(projectName)
+	if err != nil {
+		return err
+	}
+
+	// Only ask for a TTY when attached to one, so output can be piped
+	tty := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+
+	err = docker.Exec(projectName, deployDir, service, tty, args...)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+func execRemote(cfg *config.Config, projectName, branch, service string, args []string) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	// Use --local to avoid recursive remote execution. The remote end gets a
+	// terminal if we have one, and decides on a TTY for docker from that.
+	command := fmt.Sprintf("cd %s && protohost exec --local --branch %s --service %s -- %s",
+		ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName), ssh.Quote(branch), ssh.Quote(service), ssh.QuoteArgs(args))
+
+	err = client.ExecuteTerminal(command)
+	if code, ok := ssh.ExitStatus(err); ok {
+		return &ExitError{Code: code}
+	}
+	return err
+}
@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/config"
 	"github.com/thatjpcsguy/protohost/internal/git"
 	"github.com/thatjpcsguy/protohost/internal/hooks"
+	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
 
@@ -26,9 +28,15 @@ Use --local to run hooks on your local machine instead.
 
 Available hooks:
   pre-deploy     - Runs before deployment starts
-  post-deploy    - Runs after deployment completes
+  pre-build      - Runs before images are built
+  post-build     - Runs after images are built
   post-start     - Runs after containers start
   first-install  - Runs only on first deployment
+  post-deploy    - Runs after deployment completes
+  on-failure     - Runs when a deployment fails
+  pre-down       - Runs before a deployment is stopped
+  post-down      - Runs after a deployment is stopped
+  pre-cleanup    - Runs before cleanup removes a deployment
 
 Examples:
   protohost hooks post-start                    # Runs on remote (default)
@@ -39,18 +47,13 @@ Examples:
 			hookName := args[0]
 
 			// Validate hook name
-			var hookType hooks.HookType
-			switch hookName {
-			case "pre-deploy":
-				hookType = hooks.PreDeploy
-			case "post-deploy":
-				hookType = hooks.PostDeploy
-			case "post-start":
-				hookType = hooks.PostStart
-			case "first-install":
-				hookType = hooks.FirstInstall
-			default:
-				return fmt.Errorf("invalid hook name: %s. Valid options: pre-deploy, post-deploy, post-start, first-install", hookName)
+			hookType, ok := hooks.Parse(hookName)
+			if !ok {
+				names := make([]string, len(hooks.All))
+				for i, h := range hooks.All {
+					names[i] = string(h)
+				}
+				return fmt.Errorf("invalid hook name: %s. Valid options: %s", hookName, strings.Join(names, ", "))
 			}
 
 			// Default to remote unless --local is specified
@@ -86,37 +89,27 @@ func runHooks(hookType hooks.HookType, remote bool, branchOverride string) error
 	// Generate project name
 	projectName := fmt.Sprintf("%s-%s", cfg.ProjectPrefix, branch)
 
-	// Build environment variables for hook
-	hookEnv := map[string]string{
-		"PROJECT_NAME": projectName,
-		"BRANCH":       branch,
-		"REMOTE_HOST":  cfg.RemoteHost,
-	}
-
 	if remote {
-		return runHookRemote(cfg, hookType, projectName, hookEnv)
+		return runHookRemote(cfg, hookType, projectName, branch)
 	}
 
-	return runHookLocal(cfg, hookType, hookEnv)
+	return runHookLocal(cfg, hookType, projectName, branch)
 }
 
-func runHookLocal(cfg *config.Config, hookType hooks.HookType, env map[string]string) error {
+func runHookLocal(cfg *config.Config, hookType hooks.HookType, projectName, branch string) error {
 	fmt.Printf("🪝 Running %s hook locally...\n", hookType)
 
-	// Get script from config based on hook type
-	var scriptFromConfig string
-	switch hookType {
-	case hooks.PreDeploy:
-		scriptFromConfig = cfg.PreDeployScript
-	case hooks.PostDeploy:
-		scriptFromConfig = cfg.PostDeployScript
-	case hooks.PostStart:
-		scriptFromConfig = cfg.PostStartScript
-	case hooks.FirstInstall:
-		scriptFromConfig = cfg.FirstInstallScript
+	// Run with the same environment and from the same directory as during
+	// a deploy
+	deployDir, err := resolveDeployDir(projectName)
+	if err != nil {
+		return err
 	}
+	hookCtx := hookContext(projectName, branch)
+	hookCtx.DeployDir = deployDir
 
-	if err := hooks.Execute(hookType, scriptFromConfig, env); err != nil {
+	// Always report failures when running a hook by hand
+	if err := hooks.ExecuteWithPolicy(hookType, cfg, deployDir, hooks.Env(cfg, hookCtx), hooks.Abort); err != nil {
 		return fmt.Errorf("hook execution failed: %w", err)
 	}
 
@@ -124,22 +117,37 @@ func runHookLocal(cfg *config.Config, hookType hooks.HookType, env map[string]st
 	return nil
 }
 
-func runHookRemote(cfg *config.Config, hookType hooks.HookType, projectName string, env map[string]string) error {
+// hookContext returns the hook context of a deployment from the registry, or
+// just its name and branch if it isn't recorded
+func hookContext(projectName, branch string) hooks.Context {
+	reg, err := registry.New()
+	if err != nil {
+		return hooks.Context{ProjectName: projectName, Branch: branch}
+	}
+	defer func() { _ = reg.Close() }()
+
+	alloc, err := reg.GetAllocation(projectName)
+	if err != nil {
+		return hooks.Context{ProjectName: projectName, Branch: branch}
+	}
+	return hooks.ContextFor(*alloc)
+}
+
+func runHookRemote(cfg *config.Config, hookType hooks.HookType, projectName, branch string) error {
 	fmt.Printf("🪝 Running %s hook on remote server %s...\n", hookType, cfg.RemoteHost)
 
 	// Connect to remote
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	// Build remote command to run the hook
 	// The hook will be executed in the context of the deployment directory
 	// IMPORTANT: Use --local flag so the remote server runs the hook locally, not recursively remote
 	script := fmt.Sprintf(`
 set -e
-cd %s/%s
+cd %s
 
 # Check if protohost is installed
 if ! command -v protohost &> /dev/null; then
@@ -148,8 +156,8 @@ if ! command -v protohost &> /dev/null; then
 fi
 
 # Run the hook locally on the remote server (not recursively remote)
-protohost hooks %s --local
-`, cfg.RemoteBaseDir, projectName, hookType)
+%sprotohost hooks %s --local --branch %s
+`, ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName), hooks.RemoteUserPrefix(), ssh.Quote(string(hookType)), ssh.Quote(branch))
 
 	if err := client.ExecuteInteractive(script); err != nil {
 		return fmt.Errorf("remote hook execution failed: %w", err)
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
 	"github.com/thatjpcsguy/protohost/internal/git"
 	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
@@ -14,40 +17,52 @@ import (
 func NewInfoCmd() *cobra.Command {
 	var remote bool
 	var local bool
+	var branch string
+	var jsonOutput bool
+	var showUsage bool
 
 	cmd := &cobra.Command{
 		Use:   "info",
 		Short: "Show deployment info",
-		Long:  `Shows remote deployment info by default. Use --local to show local deployment info.`,
+		Long: `Shows remote deployment info by default. Use --local to show local deployment info.
+
+With --usage, also shows the deployment's CPU, memory and disk usage, which
+takes a few seconds to gather.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			branch, err := git.GetCurrentBranch()
-			if err != nil {
-				return fmt.Errorf("failed to detect branch: %w", err)
+			// Detect branch if not specified
+			if branch == "" {
+				branch, err = git.GetCurrentBranch()
+				if err != nil {
+					return fmt.Errorf("failed to detect branch: %w", err)
+				}
 			}
 
 			projectName := fmt.Sprintf("%s-%s", cfg.ProjectPrefix, branch)
 
 			// Default to remote unless --local is specified
 			if local {
-				return infoLocal(projectName)
+				return infoLocal(projectName, jsonOutput, showUsage)
 			}
 
-			return infoRemote(cfg, projectName)
+			return infoRemote(cfg, projectName, branch, jsonOutput, showUsage)
 		},
 	}
 
 	cmd.Flags().BoolVar(&remote, "remote", false, "Show remote deployment info (default, kept for backwards compatibility)")
 	cmd.Flags().BoolVar(&local, "local", false, "Show local deployment info instead of remote")
+	cmd.Flags().StringVar(&branch, "branch", "", "Branch name (defaults to current)")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the deployment as JSON")
+	cmd.Flags().BoolVar(&showUsage, "usage", false, "Show resource usage of the deployment")
 
 	return cmd
 }
 
-func infoLocal(projectName string) error {
+func infoLocal(projectName string, jsonOutput, showUsage bool) error {
 	reg, err := registry.New()
 	if err != nil {
 		return fmt.Errorf("failed to open registry: %w", err)
@@ -59,25 +74,59 @@ func infoLocal(projectName string) error {
 		return fmt.Errorf("no deployment found for %s", projectName)
 	}
 
+	var usage *docker.Usage
+	if showUsage {
+		projectsUsage, err := docker.ProjectsUsage(projectName)
+		if err != nil {
+			return fmt.Errorf("failed to get resource usage: %w", err)
+		}
+		usage = usageOf(projectsUsage, projectName)
+	}
+
+	if jsonOutput {
+		entry := listEntry{PortAllocation: *alloc, Usage: usage}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entry)
+	}
+
 	fmt.Printf("Project: %s\n", alloc.ProjectName)
 	fmt.Printf("Branch:  %s\n", alloc.Branch)
+	if alloc.Commit != "" {
+		fmt.Printf("Commit:  %s\n", alloc.Commit)
+	}
 	fmt.Printf("Status:  %s\n", alloc.Status)
 	fmt.Printf("Port:    %d\n", alloc.WebPort)
 	fmt.Printf("URL:     http://localhost:%d\n", alloc.WebPort)
+	if alloc.DeployDir != "" {
+		fmt.Printf("Dir:     %s\n", alloc.DeployDir)
+	}
 	fmt.Printf("Created: %s\n", alloc.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Expires: %s\n", alloc.ExpiresAt.Format("2006-01-02 15:04:05"))
+	if usage != nil {
+		fmt.Printf("CPU:     %.1f%%\n", usage.CPUPercent)
+		fmt.Printf("Memory:  %s\n", docker.HumanSize(usage.MemoryBytes))
+		fmt.Printf("Disk:    %s (images %s, volumes %s)\n",
+			docker.HumanSize(usage.DiskBytes()), docker.HumanSize(usage.ImageBytes), docker.HumanSize(usage.VolumeBytes))
+	}
 
 	return nil
 }
 
-func infoRemote(cfg *config.Config, projectName string) error {
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+func infoRemote(cfg *config.Config, projectName, branch string, jsonOutput, showUsage bool) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	// Use --local to avoid recursive remote execution
-	cmd := fmt.Sprintf("cd %s/%s && protohost info --local", cfg.RemoteBaseDir, projectName)
+	cmd := fmt.Sprintf("cd %s && protohost info --local --branch %s",
+		ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName), ssh.Quote(branch))
+	if jsonOutput {
+		cmd += " --json"
+	}
+	if showUsage {
+		cmd += " --usage"
+	}
 	return client.ExecuteInteractive(cmd)
 }
@@ -75,18 +75,35 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 Add custom scripts here to customize deployment behavior:
 
-- pre-deploy.sh   - Runs before deployment starts (locally)
-- post-deploy.sh  - Runs after successful deployment (locally)
-- post-start.sh   - Runs after containers start (on target)
+- pre-deploy.sh    - Runs before deployment starts (locally)
+- pre-build.sh     - Runs before images are built (on target)
+- post-build.sh    - Runs after images are built (on target)
+- post-start.sh    - Runs after containers start (on target)
 - first-install.sh - Runs only on first deployment of a branch (on target)
+- post-deploy.sh   - Runs after successful deployment (locally)
+- on-failure.sh    - Runs when a deployment fails, with $DEPLOY_ERROR (on target)
+- pre-down.sh      - Runs before a deployment is stopped (on target)
+- post-down.sh     - Runs after a deployment is stopped (on target)
+- pre-cleanup.sh   - Runs before cleanup removes an expired deployment,
+                     e.g. to dump the database before volumes go (on target)
+
+Hooks starting with pre- stop what follows if they fail; the others only
+warn. See the protohost README to change this per hook.
 
 Make sure to chmod +x your hook scripts!
 
-Example post-start.sh:
-` + "```bash" + `
-#!/bin/bash
+To split a hook into several scripts, put executables in <hook>.d/ (e.g.
+post-start.d/10-migrate, post-start.d/20-seed). They run in alphabetical
+order and the hook stops at the first one that fails.
+
+Name a hook <hook>.<service>.sh (e.g. post-start.web.sh) to run it inside
+that compose service's container instead of on the host.
+
+Example post-start.web.sh:
+` + "```sh" + `
+#!/bin/sh
 # Run database migrations
-docker compose -p $PROJECT_NAME exec web python manage.py migrate
+python manage.py migrate
 ` + "```" + `
 `
 
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
 	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
@@ -15,27 +18,40 @@ import (
 func NewListCmd() *cobra.Command {
 	var remote bool
 	var local bool
+	var jsonOutput bool
+	var showUsage bool
 
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all deployments",
-		Long:  `Lists remote deployments by default. Use --local to list local deployments.`,
+		Long: `Lists remote deployments by default. Use --local to list local deployments.
+
+With --usage, also shows the CPU, memory and disk (images and volumes) each
+deployment uses.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Default to remote unless --local is specified
 			if local {
-				return listLocal()
+				return listLocal(jsonOutput, showUsage)
 			}
-			return listRemote()
+			return listRemote(jsonOutput, showUsage)
 		},
 	}
 
 	cmd.Flags().BoolVar(&remote, "remote", false, "List remote deployments (default, kept for backwards compatibility)")
 	cmd.Flags().BoolVar(&local, "local", false, "List local deployments instead of remote")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print deployments as JSON")
+	cmd.Flags().BoolVar(&showUsage, "usage", false, "Show resource usage of each deployment")
 
 	return cmd
 }
 
-func listLocal() error {
+// listEntry is a deployment as printed by list --json
+type listEntry struct {
+	registry.PortAllocation
+	Usage *docker.Usage `json:"usage,omitempty"`
+}
+
+func listLocal(jsonOutput, showUsage bool) error {
 	reg, err := registry.New()
 	if err != nil {
 		return fmt.Errorf("failed to open registry: %w", err)
@@ -47,6 +63,28 @@ func listLocal() error {
 		return fmt.Errorf("failed to list allocations: %w", err)
 	}
 
+	var usage map[string]*docker.Usage
+	if showUsage {
+		usage, err = docker.ProjectsUsage("")
+		if err != nil {
+			return fmt.Errorf("failed to get resource usage: %w", err)
+		}
+	}
+
+	if jsonOutput {
+		entries := make([]listEntry, 0, len(allocations))
+		for _, alloc := range allocations {
+			entry := listEntry{PortAllocation: alloc}
+			if showUsage {
+				entry.Usage = usageOf(usage, alloc.ProjectName)
+			}
+			entries = append(entries, entry)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
 	if len(allocations) == 0 {
 		fmt.Println("No local deployments found")
 		return nil
@@ -66,7 +104,7 @@ func listLocal() error {
 		switch alloc.Status {
 		case "running":
 			statusStr = green(alloc.Status)
-		case "stopped":
+		case "stopped", "idle":
 			statusStr = yellow(alloc.Status)
 		case "expired":
 			statusStr = red(alloc.Status)
@@ -74,6 +112,9 @@ func listLocal() error {
 
 		fmt.Printf("%s (%s)\n", alloc.ProjectName, statusStr)
 		fmt.Printf("  Branch:   %s\n", alloc.Branch)
+		if alloc.Commit != "" {
+			fmt.Printf("  Commit:   %.12s\n", alloc.Commit)
+		}
 		fmt.Printf("  Port:     %d\n", alloc.WebPort)
 		fmt.Printf("  URL:      http://localhost:%d\n", alloc.WebPort)
 		fmt.Printf("  Created:  %s\n", alloc.CreatedAt.Format("2006-01-02 15:04:05"))
@@ -87,31 +128,71 @@ func listLocal() error {
 			fmt.Printf("  Expires:  in %d days\n", daysLeft)
 		}
 
+		if showUsage {
+			fmt.Printf("  Usage:    %s\n", usageOf(usage, alloc.ProjectName))
+		}
+
 		fmt.Println()
 	}
 
+	// Show how much of the host's running deployment quota is used
+	running, err := reg.CountRunning("")
+	if err != nil {
+		return err
+	}
+	maxRunning := 0
+	if globalCfg, err := config.LoadGlobal(); err == nil {
+		maxRunning = globalCfg.MaxRunningDeployments
+	}
+	if maxRunning > 0 {
+		usage := fmt.Sprintf("%d/%d", running, maxRunning)
+		if running >= maxRunning {
+			usage = red(usage + " (limit reached)")
+		}
+		fmt.Printf("Running deployments: %s\n", usage)
+	} else {
+		fmt.Printf("Running deployments: %d\n", running)
+	}
+
 	return nil
 }
 
-func listRemote() error {
+// usageOf returns a project's usage, or none if it has no containers
+func usageOf(usage map[string]*docker.Usage, projectName string) *docker.Usage {
+	if u := usage[projectName]; u != nil {
+		return u
+	}
+	return &docker.Usage{}
+}
+
+func listRemote(jsonOutput, showUsage bool) error {
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	fmt.Printf("Connecting to %s@%s...\n", cfg.RemoteUser, cfg.RemoteHost)
-	if cfg.RemoteJumpHost != "" {
-		fmt.Printf("   via jump host %s@%s\n", cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	// Keep JSON output clean for scripts
+	if !jsonOutput {
+		fmt.Printf("Connecting to %s@%s...\n", cfg.RemoteUser, cfg.RemoteHost)
+		if len(cfg.RemoteJumpHosts) > 0 {
+			fmt.Printf("   via jump host %s\n", cfg.JumpChain())
+		}
 	}
 
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	// Run protohost list on remote (with --local to avoid recursive remote execution)
-	if err := client.ExecuteInteractive("cd " + cfg.RemoteBaseDir + " && protohost list --local"); err != nil {
+	command := "cd " + cfg.RemoteBaseDir + " && protohost list --local"
+	if jsonOutput {
+		command += " --json"
+	}
+	if showUsage {
+		command += " --usage"
+	}
+	if err := client.ExecuteInteractive(command); err != nil {
 		return fmt.Errorf("failed to list remote deployments: %w", err)
 	}
 
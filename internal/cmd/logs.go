@@ -1,34 +1,79 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/deploy"
+	"github.com/thatjpcsguy/protohost/internal/deploylog"
 	"github.com/thatjpcsguy/protohost/internal/docker"
 	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
 
 // NewLogsCmd creates the logs command
 func NewLogsCmd() *cobra.Command {
 	var (
-		remote bool
-		local  bool
-		follow bool
-		branch string
+		remote     bool
+		local      bool
+		follow     bool
+		branch     string
+		services   []string
+		since      string
+		tail       string
+		timestamps bool
+		all        bool
+		deployID   string
+		deploys    bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "logs",
 		Short: "View logs for deployment",
-		Long:  `Views remote logs by default. Use --local to view local logs.`,
+		Long: `Views remote logs by default. Use --local to view local logs.
+
+Use --all to show the logs of every running deployment at once, each line
+prefixed with its project name.
+
+Each deploy's output is saved with the last lines of its containers' logs,
+which are kept when containers are recreated or removed. Use --deploys to
+list the saved logs and --deploy to show one.
+
+Examples:
+  protohost logs -f --service web --tail 100
+  protohost logs --since 10m --timestamps
+  protohost logs --all -f
+  protohost logs --deploy latest`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
+			opts := docker.LogsOptions{
+				Follow:     follow,
+				Services:   services,
+				Since:      since,
+				Tail:       tail,
+				Timestamps: timestamps,
+			}
+
+			if all {
+				if local {
+					return logsAllLocal(opts)
+				}
+				return logsAllRemote(cfg, opts)
+			}
+
 			// Detect branch if not specified
 			if branch == "" {
 				branch, err = git.GetCurrentBranch()
@@ -39,12 +84,19 @@ func NewLogsCmd() *cobra.Command {
 
 			projectName := fmt.Sprintf("%s-%s", cfg.ProjectPrefix, branch)
 
+			if deploys || deployID != "" {
+				if local {
+					return deployLogLocal(projectName, deployID)
+				}
+				return deployLogRemote(cfg, projectName, deployID)
+			}
+
 			// Default to remote unless --local is specified
 			if local {
-				return logsLocal(projectName, follow)
+				return logsLocal(projectName, opts)
 			}
 
-			return logsRemote(cfg, projectName, follow)
+			return logsRemote(cfg, projectName, opts)
 		},
 	}
 
@@ -52,36 +104,248 @@ func NewLogsCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&local, "local", false, "View local logs instead of remote")
 	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow log output")
 	cmd.Flags().StringVar(&branch, "branch", "", "Branch name (defaults to current)")
+	cmd.Flags().StringSliceVarP(&services, "service", "s", nil, "Only show logs of this service (repeatable)")
+	cmd.Flags().StringVar(&since, "since", "", "Show logs since a time (e.g. 2024-01-02T13:23:37Z) or duration (e.g. 10m)")
+	cmd.Flags().StringVarP(&tail, "tail", "n", "", "Number of lines to show from the end of each log (default: all)")
+	cmd.Flags().BoolVarP(&timestamps, "timestamps", "t", false, "Show timestamps")
+	cmd.Flags().BoolVar(&all, "all", false, "Show logs of every running deployment")
+	cmd.Flags().StringVar(&deployID, "deploy", "", "Show a saved deploy log by ID, or 'latest'")
+	cmd.Flags().BoolVar(&deploys, "deploys", false, "List saved deploy logs")
 
 	return cmd
 }
 
-func logsLocal(projectName string, follow bool) error {
-	// Get deployment directory
-	home, err := getUserHomeDir()
+func logsLocal(projectName string, opts docker.LogsOptions) error {
+	deployDir, err := resolveDeployDir(projectName)
+	if err != nil {
+		return err
+	}
+
+	return docker.Logs(projectName, deployDir, opts)
+}
+
+func logsRemote(cfg *config.Config, projectName string, opts docker.LogsOptions) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	cmd := fmt.Sprintf("cd %s && docker %s",
+		ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName), ssh.QuoteArgs(docker.LogsArgs(projectName, opts)))
+
+	return client.ExecuteInteractive(cmd)
+}
+
+// deployLogLocal prints a saved deploy log, or lists them if id is empty
+func deployLogLocal(projectName, id string) error {
+	ids, err := deploylog.List(projectName)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		printDeployLogs(projectName, ids)
+		return nil
+	}
+
+	paths, err := deploylog.Paths(projectName, id)
 	if err != nil {
 		return err
 	}
 
-	deployDir := fmt.Sprintf("%s/.protohost/deployments/%s", home, projectName)
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printFile(path); err != nil {
+			return err
+		}
+	}
 
-	return docker.Logs(projectName, deployDir, follow)
+	return nil
 }
 
-func logsRemote(cfg *config.Config, projectName string, follow bool) error {
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+// printFile copies a file to stdout
+func printFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open deploy log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	_, err = io.Copy(os.Stdout, file)
+	return err
+}
+
+// deployLogRemote reads saved deploy logs from the server directly, so that
+// logs of deployments that have since been removed can still be read
+func deployLogRemote(cfg *config.Config, projectName, id string) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
-	followFlag := ""
-	if follow {
-		followFlag = "-f"
+	dir := "~/.protohost/logs/" + ssh.Quote(projectName)
+	output, err := client.Execute(fmt.Sprintf("ls -1 %s 2>/dev/null || true", dir))
+	if err != nil {
+		return fmt.Errorf("failed to list deploy logs: %w", err)
 	}
 
-	cmd := fmt.Sprintf("cd %s/%s && docker compose -p %s logs %s",
-		cfg.RemoteBaseDir, projectName, projectName, followFlag)
+	ids := deploylog.IDs(strings.Fields(output))
 
-	return client.ExecuteInteractive(cmd)
+	if id == "" {
+		printDeployLogs(projectName, ids)
+		return nil
+	}
+
+	id, err = deploylog.Resolve(projectName, ids, id)
+	if err != nil {
+		return err
+	}
+
+	// Either file may be missing, e.g. container logs saved for a deployment
+	// made before deploy output was kept
+	var files []string
+	for _, name := range deploylog.Files(id) {
+		files = append(files, dir+"/"+ssh.Quote(name))
+	}
+	script := fmt.Sprintf("for f in %s; do [ -f \"$f\" ] || continue; [ -z \"$sep\" ] || echo; cat \"$f\"; sep=1; done", strings.Join(files, " "))
+
+	return client.ExecuteStream(script, os.Stdout, os.Stderr)
+}
+
+// printDeployLogs lists the IDs of saved deploy logs
+func printDeployLogs(projectName string, ids []string) {
+	if len(ids) == 0 {
+		fmt.Printf("No deploy logs found for %s\n", projectName)
+		return
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+}
+
+func logsAllLocal(opts docker.LogsOptions) error {
+	reg, err := registry.New()
+	if err != nil {
+		return fmt.Errorf("failed to open registry: %w", err)
+	}
+	allocations, err := reg.ListAllocations()
+	_ = reg.Close()
+	if err != nil {
+		return fmt.Errorf("failed to list allocations: %w", err)
+	}
+
+	return streamLogs(running(allocations), func(alloc registry.PortAllocation, stdout, stderr io.Writer) error {
+		cmd := exec.Command("docker", docker.LogsArgs(alloc.ProjectName, opts)...)
+		if alloc.DeployDir != "" && fileExists(alloc.DeployDir) {
+			cmd.Dir = alloc.DeployDir
+		}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd.Run()
+	})
+}
+
+func logsAllRemote(cfg *config.Config, opts docker.LogsOptions) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	allocations, err := deploy.RemoteAllocations(client, cfg)
+	if err != nil {
+		return err
+	}
+
+	// One SSH session per deployment, over the same connection
+	return streamLogs(running(allocations), func(alloc registry.PortAllocation, stdout, stderr io.Writer) error {
+		return client.ExecuteStream("docker "+ssh.QuoteArgs(docker.LogsArgs(alloc.ProjectName, opts)), stdout, stderr)
+	})
+}
+
+// running returns the deployments whose status is running
+func running(allocations []registry.PortAllocation) []registry.PortAllocation {
+	var result []registry.PortAllocation
+	for _, alloc := range allocations {
+		if alloc.Status == "running" {
+			result = append(result, alloc)
+		}
+	}
+	return result
+}
+
+// logColors are cycled through to tell deployments apart in --all output
+var logColors = []color.Attribute{color.FgCyan, color.FgGreen, color.FgYellow, color.FgMagenta, color.FgBlue, color.FgRed}
+
+// streamLogs runs stream for every deployment at once, prefixing each line
+// of output with the deployment's coloured project name, until they all end
+func streamLogs(allocations []registry.PortAllocation, stream func(alloc registry.PortAllocation, stdout, stderr io.Writer) error) error {
+	if len(allocations) == 0 {
+		fmt.Println("No running deployments found")
+		return nil
+	}
+
+	width := 0
+	for _, alloc := range allocations {
+		width = max(width, len(alloc.ProjectName))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, alloc := range allocations {
+		prefix := color.New(logColors[i%len(logColors)]).Sprintf("%-*s |", width, alloc.ProjectName) + " "
+		stdout := &prefixWriter{mu: &mu, out: os.Stdout, prefix: prefix}
+		stderr := &prefixWriter{mu: &mu, out: os.Stderr, prefix: prefix}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := stream(alloc, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+			if err != nil {
+				_, _ = fmt.Fprintf(stderr, "Warning: failed to read logs: %v\n", err)
+				stderr.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// prefixWriter writes whole lines to out with a prefix, so that output from
+// several streams sharing mu is interleaved line by line
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any incomplete last line
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = fmt.Fprintf(w.out, "%s%s", w.prefix, line)
 }
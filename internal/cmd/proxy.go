@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/proxy"
+	"github.com/thatjpcsguy/protohost/internal/registry"
+)
+
+// NewProxyCmd creates the proxy command
+func NewProxyCmd() *cobra.Command {
+	var listen string
+
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Proxy requests to deployments on this host, waking idle ones",
+		Long: `Runs the proxy nginx routes requests through when PROXY_PORT is set in
+~/.protohost/config. It records when each deployment was last requested, so
+'protohost daemon' can stop deployments idle for IDLE_STOP_HOURS, and starts
+a stopped deployment again on its next request, showing a "starting" page
+until it's up.
+
+It listens on PROXY_PORT of the address NGINX_PROXY_HOST resolves to (set it
+in ~/.protohost/config), or of localhost if that isn't set. Requests name the
+deployment they're for in a header, so anyone who can connect to the proxy
+can reach any deployment without going through nginx: keep it off public
+interfaces, or firewall the port to nginx.
+
+Install it as a service with 'protohost install-service --proxy'.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			globalCfg, err := config.LoadGlobal()
+			if err != nil {
+				return err
+			}
+
+			if listen == "" {
+				if globalCfg.ProxyPort == 0 {
+					return fmt.Errorf("set PROXY_PORT in ~/.protohost/config or pass --listen")
+				}
+				listen, err = proxy.Addr(globalCfg.NginxProxyHost, globalCfg.ProxyPort)
+				if err != nil {
+					return err
+				}
+			}
+
+			return runProxy(listen, globalCfg.MaxRunningDeployments)
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", "", "Address to listen on (defaults to NGINX_PROXY_HOST:PROXY_PORT)")
+
+	return cmd
+}
+
+func runProxy(listen string, maxRunning int) error {
+	reg, err := registry.New()
+	if err != nil {
+		return fmt.Errorf("failed to open registry: %w", err)
+	}
+	defer func() { _ = reg.Close() }()
+
+	server := &http.Server{Addr: listen, Handler: proxy.New(reg, maxRunning)}
+
+	// Stop on Ctrl+C or when the service is stopped
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-stop
+		_ = server.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("🔀 Proxying deployments on %s (Ctrl+C to stop)\n", listen)
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("proxy failed: %w", err)
+	}
+
+	fmt.Println("Stopping proxy")
+	return nil
+}
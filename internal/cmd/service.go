@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
+)
+
+// serviceName is the name of the systemd units installed on remote
+const serviceName = "protohost-daemon"
+
+// proxyServiceName is the name of the systemd unit running the proxy
+const proxyServiceName = "protohost-proxy"
+
+// NewInstallServiceCmd creates the install-service command
+func NewInstallServiceCmd() *cobra.Command {
+	var (
+		interval  time.Duration
+		merged    bool
+		withProxy bool
+		uninstall bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install-service",
+		Short: "Install a systemd timer on remote that runs scheduled cleanup",
+		Long: `Writes and enables a systemd user service and timer on the remote server
+that runs 'protohost daemon --once' every --interval, so expired deployments
+are removed without anyone running 'protohost cleanup'.
+
+With --proxy, also installs a service running 'protohost proxy', which idle
+deployments need to be woken (see PROXY_PORT and IDLE_STOP_HOURS).
+
+Use --uninstall to disable and remove the units.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			if uninstall {
+				return uninstallService(cfg)
+			}
+			return installService(cfg, interval, merged, withProxy)
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 15*time.Minute, "Time between maintenance passes")
+	cmd.Flags().BoolVar(&merged, "merged", false, "Also remove deployments whose branch was deleted from the repository")
+	cmd.Flags().BoolVar(&withProxy, "proxy", false, "Also install a service running the proxy that wakes idle deployments")
+	cmd.Flags().BoolVar(&uninstall, "uninstall", false, "Disable and remove the services")
+
+	return cmd
+}
+
+func installService(cfg *config.Config, interval time.Duration, merged, withProxy bool) error {
+	if interval < time.Minute {
+		return fmt.Errorf("--interval must be at least 1m")
+	}
+
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	// systemd needs an absolute path, and user units don't see the login PATH
+	output, err := client.Execute("bash -lc 'command -v protohost'")
+	binary := strings.TrimSpace(output)
+	if err != nil || binary == "" {
+		return fmt.Errorf("protohost is not installed on remote. Run 'protohost bootstrap-remote' first")
+	}
+
+	args := "daemon --once"
+	if merged {
+		args += " --merged"
+	}
+
+	service := fmt.Sprintf(`[Unit]
+Description=Protohost deployment maintenance
+
+[Service]
+Type=oneshot
+WorkingDirectory=%s
+Environment=PATH=%%h/.local/bin:/usr/local/bin:/usr/bin:/bin
+ExecStart=%s %s
+`, strings.Replace(cfg.RemoteBaseDir, "~", "%h", 1), binary, args)
+
+	timer := fmt.Sprintf(`[Unit]
+Description=Run protohost deployment maintenance every %s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+
+[Install]
+WantedBy=timers.target
+`, interval, int(interval.Seconds()))
+
+	fmt.Printf("⚙️  Installing %s service on %s...\n", serviceName, cfg.RemoteHost)
+
+	unitDir := "~/.config/systemd/user"
+	if err := client.UploadBytes([]byte(service), fmt.Sprintf("%s/%s.service", unitDir, serviceName), 0644); err != nil {
+		return fmt.Errorf("failed to write service unit: %w", err)
+	}
+	if err := client.UploadBytes([]byte(timer), fmt.Sprintf("%s/%s.timer", unitDir, serviceName), 0644); err != nil {
+		return fmt.Errorf("failed to write timer unit: %w", err)
+	}
+
+	enableCmd := fmt.Sprintf("mkdir -p %s && systemctl --user daemon-reload && systemctl --user enable --now %s.timer",
+		cfg.RemoteBaseDir, serviceName)
+	if err := client.ExecuteInteractive(enableCmd); err != nil {
+		return fmt.Errorf("failed to enable timer: %w", err)
+	}
+
+	if withProxy {
+		proxyService := fmt.Sprintf(`[Unit]
+Description=Protohost proxy that wakes idle deployments
+After=network.target
+
+[Service]
+WorkingDirectory=%s
+Environment=PATH=%%h/.local/bin:/usr/local/bin:/usr/bin:/bin
+ExecStart=%s proxy
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`, strings.Replace(cfg.RemoteBaseDir, "~", "%h", 1), binary)
+
+		fmt.Printf("⚙️  Installing %s service on %s...\n", proxyServiceName, cfg.RemoteHost)
+
+		if err := client.UploadBytes([]byte(proxyService), fmt.Sprintf("%s/%s.service", unitDir, proxyServiceName), 0644); err != nil {
+			return fmt.Errorf("failed to write proxy service unit: %w", err)
+		}
+		if err := client.ExecuteInteractive(fmt.Sprintf("systemctl --user daemon-reload && systemctl --user enable --now %s.service", proxyServiceName)); err != nil {
+			return fmt.Errorf("failed to enable proxy service: %w", err)
+		}
+	}
+
+	// Without lingering, user timers stop when the user logs out
+	if _, err := client.Execute("loginctl enable-linger"); err != nil {
+		fmt.Println("Warning: failed to enable lingering; the timer only runs while you're logged in")
+		fmt.Printf("   Run 'sudo loginctl enable-linger %s' on the remote server to fix this\n", cfg.RemoteUser)
+	}
+
+	fmt.Printf("✅ Maintenance will run every %s\n", interval)
+	fmt.Printf("   Check status with: systemctl --user status %s.timer\n", serviceName)
+	fmt.Printf("   View logs with:    journalctl --user -u %s\n", serviceName)
+	if withProxy {
+		fmt.Printf("✅ Proxy is running (set PROXY_PORT in ~/.protohost/config on %s)\n", cfg.RemoteHost)
+		fmt.Printf("   View logs with:    journalctl --user -u %s\n", proxyServiceName)
+	}
+	return nil
+}
+
+func uninstallService(cfg *config.Config) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	fmt.Printf("🗑️  Removing %s services from %s...\n", serviceName, cfg.RemoteHost)
+
+	removeCmd := fmt.Sprintf(
+		"systemctl --user disable --now %[1]s.timer; systemctl --user disable --now %[2]s.service 2>/dev/null; rm -f ~/.config/systemd/user/%[1]s.service ~/.config/systemd/user/%[1]s.timer ~/.config/systemd/user/%[2]s.service && systemctl --user daemon-reload",
+		serviceName, proxyServiceName)
+	if err := client.ExecuteInteractive(removeCmd); err != nil {
+		return fmt.Errorf("failed to remove service: %w", err)
+	}
+
+	fmt.Println("✅ Service removed")
+	return nil
+}
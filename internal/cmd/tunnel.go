@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/deploy"
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
+)
+
+// NewTunnelCmd creates the tunnel command
+func NewTunnelCmd() *cobra.Command {
+	var (
+		branch    string
+		service   string
+		port      int
+		localPort int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "tunnel",
+		Short: "Forward a port of a remote deployment to localhost",
+		Long: `Forwards a port of the branch's remote deployment to localhost over SSH
+(through any jump hosts) until interrupted.
+
+Without --service, the deployment's web port is forwarded. With --service,
+the port the service publishes on the server is forwarded, or if it doesn't
+publish one, its container port on the Docker network.
+
+Examples:
+  protohost tunnel                            # Web port
+  protohost tunnel --service db               # e.g. then psql -h localhost
+  protohost tunnel --service db --local-port 15432
+  protohost tunnel --service api --port 9229  # Pick one of several ports`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Detect branch if not specified
+			if branch == "" {
+				branch, err = git.GetCurrentBranch()
+				if err != nil {
+					return fmt.Errorf("failed to detect branch: %w", err)
+				}
+			}
+
+			projectName := fmt.Sprintf("%s-%s", cfg.ProjectPrefix, branch)
+
+			return runTunnel(cfg, projectName, service, port, localPort)
+		},
+	}
+
+	cmd.Flags().StringVar(&branch, "branch", "", "Branch name (defaults to current)")
+	cmd.Flags().StringVarP(&service, "service", "s", "", "Compose service to forward (defaults to the web port)")
+	cmd.Flags().IntVar(&port, "port", 0, "Container port of the service, if it has several")
+	cmd.Flags().IntVar(&localPort, "local-port", 0, "Local port to listen on (defaults to the remote port, or any free port if it's taken)")
+
+	return cmd
+}
+
+func runTunnel(cfg *config.Config, projectName, service string, port, localPort int) error {
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	var target string
+	var targetPort int
+	if service == "" {
+		alloc, err := deploy.RemoteAllocation(client, cfg, projectName)
+		if err != nil {
+			return err
+		}
+		service, targetPort = "web", alloc.WebPort
+		target = net.JoinHostPort("127.0.0.1", strconv.Itoa(alloc.WebPort))
+	} else {
+		target, targetPort, err = serviceTarget(client, projectName, service, port)
+		if err != nil {
+			return err
+		}
+	}
+
+	listener, err := listenLocal(localPort, targetPort)
+	if err != nil {
+		return err
+	}
+
+	// Stop forwarding on Ctrl+C
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-stop
+		_ = listener.Close()
+	}()
+
+	fmt.Printf("🔗 Forwarding localhost:%d to %s of %s (%s on %s)\n",
+		listener.Addr().(*net.TCPAddr).Port, service, projectName, target, cfg.RemoteHost)
+	fmt.Println("   Press Ctrl+C to stop")
+
+	if err := client.Forward(listener, target); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("✓ Tunnel closed")
+	return nil
+}
+
+// serviceTarget finds the address on the remote server to forward to for a
+// service: the host port it publishes, or else its container address on the
+// Docker network. port picks a container port if the service has several.
+func serviceTarget(client *ssh.Client, projectName, service string, port int) (string, int, error) {
+	output, err := client.Execute(fmt.Sprintf("docker compose -p %s ps --format json %s",
+		ssh.Quote(projectName), ssh.Quote(service)))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to list containers of %s: %w", service, err)
+	}
+
+	containers, err := docker.ParseContainers([]byte(output))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var container *docker.Container
+	for i := range containers {
+		if containers[i].Service == service && containers[i].State == "running" {
+			container = &containers[i]
+			break
+		}
+	}
+	if container == nil {
+		return "", 0, fmt.Errorf("service %s of %s isn't running", service, projectName)
+	}
+
+	// Prefer a port published on the host
+	published := make(map[int]int)
+	for _, p := range container.Publishers {
+		if p.PublishedPort != 0 && (port == 0 || p.TargetPort == port) {
+			published[p.TargetPort] = p.PublishedPort
+		}
+	}
+	targetPort, err := pickPort(service, published)
+	if err != nil {
+		return "", 0, err
+	}
+	if targetPort != 0 {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(published[targetPort])), targetPort, nil
+	}
+
+	// Otherwise connect to the container directly
+	output, err = client.Execute("docker inspect " + ssh.Quote(container.ID))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to inspect container of %s: %w", service, err)
+	}
+
+	var inspect []struct {
+		Config struct {
+			ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		} `json:"Config"`
+		NetworkSettings struct {
+			Networks map[string]struct {
+				IPAddress string `json:"IPAddress"`
+			} `json:"Networks"`
+		} `json:"NetworkSettings"`
+	}
+	if err := json.Unmarshal([]byte(output), &inspect); err != nil || len(inspect) == 0 {
+		return "", 0, fmt.Errorf("failed to parse container of %s", service)
+	}
+
+	targetPort = port
+	if targetPort == 0 {
+		exposed := make(map[int]int)
+		for spec := range inspect[0].Config.ExposedPorts {
+			number, proto, _ := strings.Cut(spec, "/")
+			if n, err := strconv.Atoi(number); err == nil && proto == "tcp" {
+				exposed[n] = n
+			}
+		}
+		if targetPort, err = pickPort(service, exposed); err != nil {
+			return "", 0, err
+		}
+		if targetPort == 0 {
+			return "", 0, fmt.Errorf("service %s doesn't expose a port, pick one with --port", service)
+		}
+	}
+
+	networks := make([]string, 0, len(inspect[0].NetworkSettings.Networks))
+	for name := range inspect[0].NetworkSettings.Networks {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	for _, name := range networks {
+		if ip := inspect[0].NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return net.JoinHostPort(ip, strconv.Itoa(targetPort)), targetPort, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("service %s has no network address", service)
+}
+
+// pickPort returns the only key of ports, 0 if there are none, or an error
+// asking for --port if there are several
+func pickPort(service string, ports map[int]int) (int, error) {
+	keys := make([]int, 0, len(ports))
+	for k := range ports {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	switch len(keys) {
+	case 0:
+		return 0, nil
+	case 1:
+		return keys[0], nil
+	}
+
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = strconv.Itoa(k)
+	}
+	return 0, fmt.Errorf("service %s has several ports (%s), pick one with --port", service, strings.Join(names, ", "))
+}
+
+// listenLocal listens on localPort, or if it's 0 on preferred, falling back
+// to any free port if preferred is taken
+func listenLocal(localPort, preferred int) (net.Listener, error) {
+	if localPort != 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on port %d: %w", localPort, err)
+		}
+		return listener, nil
+	}
+
+	if listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(preferred))); err == nil {
+		return listener, nil
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	return listener, nil
+}
@@ -6,7 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config represents the protohost configuration
@@ -25,12 +28,63 @@ type Config struct {
 	NginxProxyHost string
 	NginxServer    string
 
+	// Jump host chain, dialed in order (parsed from REMOTE_JUMP_HOSTS,
+	// or built from REMOTE_JUMP_HOST/REMOTE_JUMP_USER)
+	RemoteJumpHosts []JumpHost
+
 	// Port settings
 	BaseWebPort int
 
 	// SSH settings
 	SSHKeyPath string
 
+	// Local files uploaded into the remote deployment directory (e.g. .env.preview)
+	EnvFiles []string
+
+	// Registry used to ship locally built images (streamed over SSH if empty)
+	ImageRegistry string
+
+	// Ref fetched for `deploy --pr N`; {number} is replaced with N
+	PRRefPattern string
+
+	// Git fetch depth for deployment checkouts (0 for full history)
+	GitDepth int
+
+	// Default resource limits for each service, unless it sets its own
+	DefaultCPULimit    string // e.g. "1.5"
+	DefaultMemoryLimit string // e.g. "1g"
+
+	// Host-wide maximum of running deployments (0 for no limit; only read
+	// from the global config)
+	MaxRunningDeployments int
+
+	// Port of the protohost proxy nginx routes requests through, to track
+	// activity and wake idle deployments (0 to proxy to deployments directly)
+	ProxyPort int
+
+	// Hours without requests after which a deployment is stopped until it's
+	// requested again (0 to never stop; needs ProxyPort)
+	IdleStopHours int
+
+	// Expiry notifications (usually set in the global config on the server)
+	ExpiryWebhookURL    string
+	ExpiryWebhookFormat string // "generic" (default) or "slack"
+	ExpiryWarningHours  int
+
+	// Saved deploy logs (~/.protohost/logs)
+	LogRetentionDays int // Deploy logs older than this are pruned on cleanup
+	LogTailLines     int // Container log lines kept per container (0 disables)
+
+	// Lifecycle event webhooks
+	WebhookURLs    []string
+	WebhookSecret  string // Key for the X-Protohost-Signature HMAC
+	WebhookRetries int
+
+	// Git forge commit statuses and deployments
+	ForgeType  string // "github" or "gitea"; inferred from RepoURL if empty
+	ForgeURL   string // API base URL; inferred from RepoURL if empty
+	ForgeToken string
+
 	// SSL settings
 	SSLCertPath   string
 	SSLKeyPath    string
@@ -41,36 +95,64 @@ type Config struct {
 	PostDeployScript   string
 	PostStartScript    string
 	FirstInstallScript string
+	PreBuildScript     string
+	PostBuildScript    string
+	PreDownScript      string
+	PostDownScript     string
+	PreCleanupScript   string
+	OnFailureScript    string
+
+	// Per-hook options, keyed by hook name (e.g. "post-start")
+	HookSettings map[string]HookSettings
+}
+
+// HookSettings are per-hook options, set with <HOOK>_TIMEOUT, <HOOK>_RETRIES,
+// <HOOK>_ON_FAILURE and <HOOK>_SERVICE (e.g. POST_START_TIMEOUT=5m)
+type HookSettings struct {
+	Timeout   time.Duration // 0 means no timeout
+	Retries   int           // Extra attempts after a failure
+	OnFailure string        // "abort", "warn" or "rollback"; empty uses the hook's default
+	Service   string        // Compose service to run the <HOOK>_SCRIPT in; empty runs it on the host
+}
+
+// JumpHost is a single hop in a jump host chain
+type JumpHost struct {
+	User    string
+	Host    string
+	Port    int
+	KeyPath string // Optional, defaults to SSHKeyPath
+}
+
+// String returns the hop as user@host[:port]
+func (j JumpHost) String() string {
+	if j.Port != 0 && j.Port != 22 {
+		return fmt.Sprintf("%s@%s:%d", j.User, j.Host, j.Port)
+	}
+	return fmt.Sprintf("%s@%s", j.User, j.Host)
 }
 
 // Load reads and parses the .protohost.config file
 func Load() (*Config, error) {
-	cfg := &Config{
-		// Set defaults
-		TTLDays:       7,
-		BaseWebPort:   3000,
-		SSLParamsFile: "ssl-params.conf",
-	}
+	return LoadDir(".")
+}
 
+// LoadDir reads and parses the .protohost.config file in dir
+func LoadDir(dir string) (*Config, error) {
 	// Load global config first (lowest priority)
-	home, err := os.UserHomeDir()
-	if err == nil {
-		globalConfigPath := filepath.Join(home, ".protohost", "config")
-		if _, err := os.Stat(globalConfigPath); err == nil {
-			if err := loadConfigFile(globalConfigPath, cfg); err != nil {
-				return nil, fmt.Errorf("failed to load global config: %w", err)
-			}
-		}
+	cfg, err := loadGlobal()
+	if err != nil {
+		return nil, err
 	}
 
 	// Load main config
-	if err := loadConfigFile(".protohost.config", cfg); err != nil {
+	if err := loadConfigFile(filepath.Join(dir, ".protohost.config"), cfg); err != nil {
 		return nil, fmt.Errorf("failed to load .protohost.config: %w", err)
 	}
 
 	// Load local overrides if they exist (highest priority)
-	if _, err := os.Stat(".protohost.config.local"); err == nil {
-		if err := loadConfigFile(".protohost.config.local", cfg); err != nil {
+	localPath := filepath.Join(dir, ".protohost.config.local")
+	if _, err := os.Stat(localPath); err == nil {
+		if err := loadConfigFile(localPath, cfg); err != nil {
 			return nil, fmt.Errorf("failed to load .protohost.config.local: %w", err)
 		}
 	}
@@ -88,6 +170,50 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// LoadGlobal reads only the global ~/.protohost/config, for host-wide
+// settings used outside a project directory (e.g. by cleanup and daemon).
+// Project fields aren't validated.
+func LoadGlobal() (*Config, error) {
+	cfg, err := loadGlobal()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.expandVariables(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadGlobal returns the defaults overlaid with the global config, if any
+func loadGlobal() (*Config, error) {
+	cfg := &Config{
+		// Set defaults
+		TTLDays:             7,
+		BaseWebPort:         3000,
+		SSLParamsFile:       "ssl-params.conf",
+		PRRefPattern:        "refs/pull/{number}/head",
+		ExpiryWebhookFormat: "generic",
+		ExpiryWarningHours:  24,
+		LogRetentionDays:    14,
+		LogTailLines:        500,
+		WebhookRetries:      3,
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		globalConfigPath := filepath.Join(home, ".protohost", "config")
+		if _, err := os.Stat(globalConfigPath); err == nil {
+			if err := loadConfigFile(globalConfigPath, cfg); err != nil {
+				return nil, fmt.Errorf("failed to load global config: %w", err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
 // loadConfigFile parses a bash-style config file
 func loadConfigFile(filename string, cfg *Config) error {
 	file, err := os.Open(filename)
@@ -134,6 +260,12 @@ func loadConfigFile(filename string, cfg *Config) error {
 			cfg.RemoteJumpHost = value
 		case "REMOTE_JUMP_USER":
 			cfg.RemoteJumpUser = value
+		case "REMOTE_JUMP_HOSTS":
+			hops, err := parseJumpHosts(value)
+			if err != nil {
+				return err
+			}
+			cfg.RemoteJumpHosts = hops
 		case "NGINX_PROXY_HOST":
 			cfg.NginxProxyHost = value
 		case "NGINX_SERVER":
@@ -142,6 +274,46 @@ func loadConfigFile(filename string, cfg *Config) error {
 			_, _ = fmt.Sscanf(value, "%d", &cfg.BaseWebPort)
 		case "SSH_KEY_PATH":
 			cfg.SSHKeyPath = value
+		case "ENV_FILES":
+			cfg.EnvFiles = splitList(value)
+		case "IMAGE_REGISTRY":
+			cfg.ImageRegistry = value
+		case "PR_REF_PATTERN":
+			cfg.PRRefPattern = value
+		case "GIT_DEPTH":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.GitDepth)
+		case "DEFAULT_CPU_LIMIT":
+			cfg.DefaultCPULimit = value
+		case "DEFAULT_MEMORY_LIMIT":
+			cfg.DefaultMemoryLimit = value
+		case "MAX_RUNNING_DEPLOYMENTS":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.MaxRunningDeployments)
+		case "PROXY_PORT":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.ProxyPort)
+		case "IDLE_STOP_HOURS":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.IdleStopHours)
+		case "EXPIRY_WEBHOOK_URL":
+			cfg.ExpiryWebhookURL = value
+		case "EXPIRY_WEBHOOK_FORMAT":
+			cfg.ExpiryWebhookFormat = value
+		case "EXPIRY_WARNING_HOURS":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.ExpiryWarningHours)
+		case "LOG_RETENTION_DAYS":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.LogRetentionDays)
+		case "LOG_TAIL_LINES":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.LogTailLines)
+		case "WEBHOOK_URLS":
+			cfg.WebhookURLs = splitList(value)
+		case "WEBHOOK_SECRET":
+			cfg.WebhookSecret = value
+		case "WEBHOOK_RETRIES":
+			_, _ = fmt.Sscanf(value, "%d", &cfg.WebhookRetries)
+		case "FORGE_TYPE":
+			cfg.ForgeType = value
+		case "FORGE_URL":
+			cfg.ForgeURL = value
+		case "FORGE_TOKEN":
+			cfg.ForgeToken = value
 		case "SSL_CERT_PATH":
 			cfg.SSLCertPath = value
 		case "SSL_KEY_PATH":
@@ -156,12 +328,196 @@ func loadConfigFile(filename string, cfg *Config) error {
 			cfg.PostStartScript = value
 		case "FIRST_INSTALL_SCRIPT":
 			cfg.FirstInstallScript = value
+		case "PRE_BUILD_SCRIPT":
+			cfg.PreBuildScript = value
+		case "POST_BUILD_SCRIPT":
+			cfg.PostBuildScript = value
+		case "PRE_DOWN_SCRIPT":
+			cfg.PreDownScript = value
+		case "POST_DOWN_SCRIPT":
+			cfg.PostDownScript = value
+		case "PRE_CLEANUP_SCRIPT":
+			cfg.PreCleanupScript = value
+		case "ON_FAILURE_SCRIPT":
+			cfg.OnFailureScript = value
+		default:
+			if err := parseHookSetting(cfg, key, value); err != nil {
+				return err
+			}
 		}
 	}
 
 	return scanner.Err()
 }
 
+// HookNames lists the hooks that take settings, as named by hooks.All
+var HookNames = []string{
+	"pre-deploy", "pre-build", "post-build", "post-start", "first-install", "post-deploy",
+	"on-failure", "pre-down", "post-down", "pre-cleanup",
+}
+
+// parseHookSetting handles <HOOK>_TIMEOUT, <HOOK>_RETRIES, <HOOK>_ON_FAILURE
+// and <HOOK>_SERVICE keys for the hooks in HookNames. Other keys, such as a
+// project's own DB_TIMEOUT, are ignored.
+func parseHookSetting(cfg *Config, key, value string) error {
+	for _, suffix := range []string{"_TIMEOUT", "_RETRIES", "_ON_FAILURE", "_SERVICE"} {
+		prefix, ok := strings.CutSuffix(key, suffix)
+		if !ok || prefix == "" {
+			continue
+		}
+
+		name := strings.ToLower(strings.ReplaceAll(prefix, "_", "-"))
+		if !slices.Contains(HookNames, name) {
+			continue
+		}
+		if cfg.HookSettings == nil {
+			cfg.HookSettings = make(map[string]HookSettings)
+		}
+		settings := cfg.HookSettings[name]
+
+		switch suffix {
+		case "_TIMEOUT":
+			timeout, err := parseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+			settings.Timeout = timeout
+		case "_RETRIES":
+			_, _ = fmt.Sscanf(value, "%d", &settings.Retries)
+		case "_ON_FAILURE":
+			switch value {
+			case "abort", "warn", "rollback":
+				settings.OnFailure = value
+			default:
+				return fmt.Errorf("invalid %s %q (expected abort, warn or rollback)", key, value)
+			}
+		case "_SERVICE":
+			settings.Service = value
+		}
+
+		cfg.HookSettings[name] = settings
+		return nil
+	}
+
+	return nil
+}
+
+// parseDuration parses a Go duration (e.g. 5m, 90s) or a number of seconds
+func parseDuration(value string) (time.Duration, error) {
+	var seconds int
+	if _, err := fmt.Sscanf(value, "%d", &seconds); err == nil && fmt.Sprint(seconds) == value {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Hook returns the settings for a hook, by name (e.g. "post-start")
+func (c *Config) Hook(name string) HookSettings {
+	if c == nil {
+		return HookSettings{}
+	}
+	return c.HookSettings[name]
+}
+
+// HookScript returns the <HOOK>_SCRIPT fallback for a hook, by name
+func (c *Config) HookScript(name string) string {
+	if c == nil {
+		return ""
+	}
+
+	switch name {
+	case "pre-deploy":
+		return c.PreDeployScript
+	case "post-deploy":
+		return c.PostDeployScript
+	case "post-start":
+		return c.PostStartScript
+	case "first-install":
+		return c.FirstInstallScript
+	case "pre-build":
+		return c.PreBuildScript
+	case "post-build":
+		return c.PostBuildScript
+	case "pre-down":
+		return c.PreDownScript
+	case "post-down":
+		return c.PostDownScript
+	case "pre-cleanup":
+		return c.PreCleanupScript
+	case "on-failure":
+		return c.OnFailureScript
+	}
+
+	return ""
+}
+
+// parseJumpHosts parses a comma-separated jump host chain.
+// Each hop has the form [user@]host[:port][?key=/path/to/key]
+func parseJumpHosts(value string) ([]JumpHost, error) {
+	var hops []JumpHost
+
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		var hop JumpHost
+
+		if idx := strings.Index(spec, "?"); idx >= 0 {
+			opt := spec[idx+1:]
+			spec = spec[:idx]
+			if !strings.HasPrefix(opt, "key=") {
+				return nil, fmt.Errorf("invalid REMOTE_JUMP_HOSTS option %q (expected key=<path>)", opt)
+			}
+			hop.KeyPath = strings.TrimPrefix(opt, "key=")
+		}
+
+		if idx := strings.Index(spec, "@"); idx >= 0 {
+			hop.User = spec[:idx]
+			spec = spec[idx+1:]
+		}
+
+		if idx := strings.LastIndex(spec, ":"); idx >= 0 {
+			port, err := strconv.Atoi(spec[idx+1:])
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("invalid port in REMOTE_JUMP_HOSTS entry %q", spec)
+			}
+			hop.Port = port
+			spec = spec[:idx]
+		}
+
+		if spec == "" {
+			return nil, fmt.Errorf("missing host in REMOTE_JUMP_HOSTS")
+		}
+		hop.Host = spec
+
+		hops = append(hops, hop)
+	}
+
+	return hops, nil
+}
+
+// splitList splits a comma-separated config value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// JumpChain describes the jump host chain for display, e.g. "a@b → c@d"
+func (c *Config) JumpChain() string {
+	parts := make([]string, len(c.RemoteJumpHosts))
+	for i, hop := range c.RemoteJumpHosts {
+		parts[i] = hop.String()
+	}
+	return strings.Join(parts, " → ")
+}
+
 // expandVariables expands environment variables and tildes in paths
 func (c *Config) expandVariables() error {
 	// Expand ${USER} in RemoteUser
@@ -169,9 +525,9 @@ func (c *Config) expandVariables() error {
 		c.RemoteUser = os.Getenv("USER")
 	}
 
-	// Default RemoteJumpUser to RemoteUser if not specified
-	if c.RemoteJumpHost != "" && c.RemoteJumpUser == "" {
-		c.RemoteJumpUser = c.RemoteUser
+	// A single REMOTE_JUMP_HOST is a one-hop chain
+	if len(c.RemoteJumpHosts) == 0 && c.RemoteJumpHost != "" {
+		c.RemoteJumpHosts = []JumpHost{{User: c.RemoteJumpUser, Host: c.RemoteJumpHost}}
 	}
 
 	// Expand ~ in SSHKeyPath (local path)
@@ -183,6 +539,30 @@ func (c *Config) expandVariables() error {
 		c.SSHKeyPath = strings.Replace(c.SSHKeyPath, "~", homeDir, 1)
 	}
 
+	// Fill in per-hop defaults
+	for i := range c.RemoteJumpHosts {
+		hop := &c.RemoteJumpHosts[i]
+		if hop.User == "" {
+			hop.User = c.RemoteJumpUser
+		}
+		if hop.User == "" {
+			hop.User = c.RemoteUser
+		}
+		if hop.Port == 0 {
+			hop.Port = 22
+		}
+		if strings.HasPrefix(hop.KeyPath, "~") {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("failed to expand ~ in REMOTE_JUMP_HOSTS key: %w", err)
+			}
+			hop.KeyPath = strings.Replace(hop.KeyPath, "~", homeDir, 1)
+		}
+		if hop.KeyPath == "" {
+			hop.KeyPath = c.SSHKeyPath
+		}
+	}
+
 	// Don't expand ~ in RemoteBaseDir - let the remote shell handle it
 	// This allows ~/protohost to work correctly on remote servers
 
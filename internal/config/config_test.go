@@ -0,0 +1,127 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJumpHosts(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []JumpHost
+		err   string
+	}{
+		{"empty", "", nil, ""},
+		{"host only", "bastion", []JumpHost{{Host: "bastion"}}, ""},
+		{"user and port", "ops@bastion:2222", []JumpHost{{User: "ops", Host: "bastion", Port: 2222}}, ""},
+		{"key", "ops@bastion?key=~/.ssh/jump", []JumpHost{{User: "ops", Host: "bastion", KeyPath: "~/.ssh/jump"}}, ""},
+		{"port and key", "bastion:2200?key=/k", []JumpHost{{Host: "bastion", Port: 2200, KeyPath: "/k"}}, ""},
+		{
+			"chain with spaces and empty entries", " a@one , ,two:23 ",
+			[]JumpHost{{User: "a", Host: "one"}, {Host: "two", Port: 23}}, "",
+		},
+		{"missing host", "ops@:22", nil, "missing host"},
+		{"non-numeric port", "bastion:ssh", nil, "invalid port"},
+		{"trailing garbage in port", "bastion:22x", nil, "invalid port"},
+		{"port zero", "bastion:0", nil, "invalid port"},
+		{"port out of range", "bastion:65536", nil, "invalid port"},
+		{"unknown option", "bastion?user=x", nil, "invalid REMOTE_JUMP_HOSTS option"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJumpHosts(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseJumpHosts(%q) error = %v, want one containing %q", tt.value, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJumpHosts(%q) error = %v", tt.value, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJumpHosts(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJumpHostString(t *testing.T) {
+	tests := []struct {
+		hop  JumpHost
+		want string
+	}{
+		{JumpHost{User: "ops", Host: "bastion"}, "ops@bastion"},
+		{JumpHost{User: "ops", Host: "bastion", Port: 22}, "ops@bastion"},
+		{JumpHost{User: "ops", Host: "bastion", Port: 2222}, "ops@bastion:2222"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.hop.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.hop, got, tt.want)
+		}
+	}
+}
+
+func TestParseHookSetting(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  map[string]HookSettings
+		err   bool
+	}{
+		{"timeout in seconds", "POST_START_TIMEOUT", "90", map[string]HookSettings{"post-start": {Timeout: 90 * time.Second}}, false},
+		{"timeout as duration", "FIRST_INSTALL_TIMEOUT", "5m", map[string]HookSettings{"first-install": {Timeout: 5 * time.Minute}}, false},
+		{"retries", "PRE_DEPLOY_RETRIES", "2", map[string]HookSettings{"pre-deploy": {Retries: 2}}, false},
+		{"on failure", "POST_DEPLOY_ON_FAILURE", "rollback", map[string]HookSettings{"post-deploy": {OnFailure: "rollback"}}, false},
+		{"service", "ON_FAILURE_SERVICE", "web", map[string]HookSettings{"on-failure": {Service: "web"}}, false},
+		{"project key with a hook suffix", "DB_TIMEOUT", "30", nil, false},
+		{"unknown hook", "POST_RELEASE_ON_FAILURE", "sometimes", nil, false},
+		{"suffix alone", "_TIMEOUT", "30", nil, false},
+		{"unrelated key", "COMPOSE_PROFILES", "dev", nil, false},
+		{"invalid timeout", "POST_START_TIMEOUT", "soon", nil, true},
+		{"invalid policy", "PRE_BUILD_ON_FAILURE", "ignore", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			err := parseHookSetting(cfg, tt.key, tt.value)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseHookSetting(%s=%s) succeeded, want an error", tt.key, tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHookSetting(%s=%s) error = %v", tt.key, tt.value, err)
+			}
+			if !reflect.DeepEqual(cfg.HookSettings, tt.want) {
+				t.Errorf("parseHookSetting(%s=%s) settings = %+v, want %+v", tt.key, tt.value, cfg.HookSettings, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHookSettingMerges(t *testing.T) {
+	cfg := &Config{}
+	for key, value := range map[string]string{
+		"POST_START_TIMEOUT":    "30",
+		"POST_START_RETRIES":    "1",
+		"POST_START_ON_FAILURE": "warn",
+	} {
+		if err := parseHookSetting(cfg, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := HookSettings{Timeout: 30 * time.Second, Retries: 1, OnFailure: "warn"}
+	if got := cfg.Hook("post-start"); got != want {
+		t.Errorf("Hook(post-start) = %+v, want %+v", got, want)
+	}
+}
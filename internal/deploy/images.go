@@ -0,0 +1,129 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
+)
+
+// buildAndShipImages builds the project's images locally for the remote's
+// platform and makes them available to the remote docker daemon, either by
+// streaming them over SSH or, if IMAGE_REGISTRY is set, by pushing them and
+// pulling on remote. Images are built from the local working tree, so unless
+// it was synced it must be clean and at the commit being deployed.
+func buildAndShipImages(client *ssh.Client, cfg *config.Config, projectName, commit string, sync bool) error {
+	dirty, err := git.IsDirty(".")
+	if err != nil {
+		return err
+	}
+
+	if !sync {
+		if dirty {
+			return fmt.Errorf("the working tree has uncommitted changes the remote checkout doesn't; commit and push them, or deploy with --sync")
+		}
+		if head, err := git.GetCommit("."); commit != "" && (err != nil || head != commit) {
+			return fmt.Errorf("local HEAD isn't the commit being deployed (%s); check it out, or deploy with --sync", commit)
+		}
+	}
+
+	// Tag images with the commit they were built from
+	tag, err := git.GetCurrentCommit()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		tag += "-dirty"
+	}
+
+	remoteOS, remoteArch, err := remotePlatform(client)
+	if err != nil {
+		return err
+	}
+
+	if err := docker.BuildFor(projectName, ".", remoteOS+"/"+remoteArch); err != nil {
+		return err
+	}
+
+	images, err := docker.BuiltImages(projectName, ".")
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		fmt.Println("No services with a build section, nothing to ship")
+		return nil
+	}
+
+	if cfg.ImageRegistry != "" {
+		return pushAndPullImages(client, cfg.ImageRegistry, images, tag)
+	}
+
+	return streamImages(client, images, tag)
+}
+
+// streamImages tags each image and pipes `docker save` into
+// `docker load` on remote
+func streamImages(client *ssh.Client, images []string, tag string) error {
+	refs := make([]string, 0, len(images)*2)
+	for _, image := range images {
+		taggedRef := fmt.Sprintf("%s:%s", imageRepo(image), tag)
+		if err := docker.Tag(image, taggedRef); err != nil {
+			return err
+		}
+		refs = append(refs, image, taggedRef)
+	}
+
+	fmt.Printf("📦 Shipping %d image(s) to remote...\n", len(images))
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(docker.Save(refs, pw))
+	}()
+
+	if err := client.ExecuteWithStdin("docker load", pr); err != nil {
+		_ = pr.Close()
+		return fmt.Errorf("failed to load images on remote: %w", err)
+	}
+
+	return nil
+}
+
+// pushAndPullImages pushes tagged images to the registry, then pulls
+// them on remote and retags them with the names Docker Compose expects
+func pushAndPullImages(client *ssh.Client, registry string, images []string, tag string) error {
+	var remoteCmds []string
+
+	for _, image := range images {
+		ref := fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(registry, "/"), path.Base(imageRepo(image)), tag)
+		if err := docker.Tag(image, ref); err != nil {
+			return err
+		}
+
+		fmt.Printf("📤 Pushing %s...\n", ref)
+		if err := docker.Push(ref); err != nil {
+			return err
+		}
+
+		remoteCmds = append(remoteCmds, fmt.Sprintf("docker pull %s && docker tag %s %s", ref, ref, image))
+	}
+
+	fmt.Println("📥 Pulling images on remote...")
+	if err := client.ExecuteInteractive(strings.Join(remoteCmds, " && ")); err != nil {
+		return fmt.Errorf("failed to pull images on remote: %w", err)
+	}
+
+	return nil
+}
+
+// imageRepo strips the tag from an image reference
+func imageRepo(image string) string {
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		return image[:idx]
+	}
+	return image
+}
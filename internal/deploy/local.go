@@ -6,7 +6,9 @@ import (
 	"path/filepath"
 
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/deploylog"
 	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/events"
 	"github.com/thatjpcsguy/protohost/internal/git"
 	"github.com/thatjpcsguy/protohost/internal/hooks"
 	"github.com/thatjpcsguy/protohost/internal/nginx"
@@ -15,22 +17,35 @@ import (
 
 // LocalOptions contains options for local deployment
 type LocalOptions struct {
-	Branch string
-	Clean  bool
-	Build  bool
+	Branch    string
+	Clean     bool
+	Build     bool
+	InPlace   bool   // Deploy from the current directory as-is, even if it isn't a git checkout
+	SkipBuild bool   // Images were built elsewhere and loaded into the local daemon
+	Ref       string // Deploy a specific commit or tag instead of a branch
+	PR        int    // Deploy a pull request instead of a branch
+	Commit    string // Commit to record when the directory isn't a git checkout
+	Depth     int    // Git fetch depth, overriding GIT_DEPTH
+	Managed   bool   // The deploy directory was created by protohost and may be removed on cleanup
 }
 
 // Local performs a local deployment
-func Local(opts LocalOptions) error {
+func Local(opts LocalOptions) (err error) {
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Detect branch if not specified
+	// Work out what to deploy: a ref or PR, or a branch (detected if not specified)
 	branch := opts.Branch
-	if branch == "" {
+	fetchRef := ""
+	if opts.Ref != "" || opts.PR != 0 {
+		branch, fetchRef, err = resolveRef(cfg, opts.Ref, opts.PR)
+		if err != nil {
+			return err
+		}
+	} else if branch == "" {
 		branch, err = git.GetCurrentBranch()
 		if err != nil {
 			return fmt.Errorf("failed to detect branch: %w", err)
@@ -40,16 +55,59 @@ func Local(opts LocalOptions) error {
 	// Generate project name
 	projectName := fmt.Sprintf("%s-%s", cfg.ProjectPrefix, branch)
 
+	// Keep the previous containers' last logs before they're recreated, then
+	// save this deploy's output alongside them
+	if err := deploylog.SaveContainerLogs(projectName, cfg.LogTailLines); err != nil {
+		fmt.Printf("Warning: failed to save container logs: %v\n", err)
+	}
+	if deployLog, logErr := deploylog.Start(projectName); logErr != nil {
+		fmt.Printf("Warning: deploy output won't be saved: %v\n", logErr)
+	} else {
+		defer func() { deployLog.Close(err) }()
+	}
+
 	fmt.Printf("🚀 Deploying %s locally...\n", projectName)
 	fmt.Println()
 
+	emitter := events.New(cfg)
+	emitter.Emit(events.Event{Type: events.DeployStarted, Project: projectName, Branch: branch, Ref: fetchRef})
+
+	// Set once containers are started, to undo the deployment if a hook
+	// fails with on_failure=rollback
+	var rollback func()
+
+	// Set once a port is allocated, which marks the deployment running
+	allocated := false
+
+	// Hooks run from the deployment directory once it's known, and their
+	// environment fills in as the deployment progresses. Building it
+	// inspects containers and git, so it's only rebuilt between phases.
+	hookDir := "."
+	hookCtx := hooks.Context{ProjectName: projectName, Branch: branch, Ref: fetchRef}
+	hookEnv := hooks.Env(cfg, hookCtx)
+
+	defer func() {
+		if err != nil && rollback != nil && hooks.IsRollback(err) {
+			rollback()
+		}
+		if err != nil && allocated {
+			markFailedDeployment(projectName)
+		}
+		if err != nil {
+			// Only built on failure, with whatever the deploy got as far as
+			failureEnv := hooks.Env(cfg, hookCtx)
+			failureEnv["DEPLOY_ERROR"] = err.Error()
+			if hookErr := hooks.Execute(hooks.OnFailure, cfg, hookDir, failureEnv); hookErr != nil {
+				fmt.Printf("Warning: %v\n", hookErr)
+			}
+
+			emitter.Emit(events.Event{Type: events.DeployFailed, Project: projectName, Branch: branch, Ref: fetchRef, Error: err.Error()})
+		}
+	}()
+
 	// Execute pre-deploy hook
-	hookEnv := map[string]string{
-		"PROJECT_NAME": projectName,
-		"BRANCH":       branch,
-	}
-	if err := hooks.Execute(hooks.PreDeploy, cfg.PreDeployScript, hookEnv); err != nil {
-		return fmt.Errorf("pre-deploy hook failed: %w", err)
+	if err := hooks.Execute(hooks.PreDeploy, cfg, hookDir, hookEnv); err != nil {
+		return err
 	}
 
 	// Open registry
@@ -59,22 +117,35 @@ func Local(opts LocalOptions) error {
 	}
 	defer func() { _ = reg.Close() }()
 
+	// Remember what was deployed before, in case this deploy is rolled back
+	previous, _ := reg.GetAllocation(projectName)
+
+	// The running deployment quota is host-wide, so projects can't raise it
+	maxRunning := 0
+	if globalCfg, err := config.LoadGlobal(); err == nil {
+		maxRunning = globalCfg.MaxRunningDeployments
+	}
+
 	// Allocate port and determine if this is a new deployment
-	port, isNew, err := reg.AllocatePort(projectName, branch, cfg.RepoURL, cfg.TTLDays, cfg.BaseWebPort)
+	port, isNew, err := reg.AllocatePort(projectName, branch, cfg.RepoURL, cfg.TTLDays, cfg.BaseWebPort, maxRunning)
 	if err != nil {
 		return fmt.Errorf("failed to allocate port: %w", err)
 	}
 
+	allocated = true
+
 	fmt.Printf("📍 Allocated port: %d\n", port)
-	hookEnv["WEB_PORT"] = fmt.Sprintf("%d", port)
-	hookEnv["NGINX_PROXY_HOST"] = cfg.NginxProxyHost
-	hookEnv["NGINX_SERVER"] = cfg.NginxServer
-	hookEnv["REMOTE_HOST"] = cfg.RemoteHost
+	hookCtx.WebPort = port
+	hookCtx.FirstInstall = &isNew
+	if alloc, err := reg.GetAllocation(projectName); err == nil {
+		hookCtx.ExpiresAt = alloc.ExpiresAt
+	}
 
 	// For local deployment, use current directory if in a git repo
 	var deployDir string
+	managed := opts.Managed
 
-	if git.IsGitRepo() {
+	if opts.InPlace || (fetchRef == "" && git.IsGitRepo()) {
 		// Use current directory
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -90,14 +161,47 @@ func Local(opts LocalOptions) error {
 		}
 
 		deployDir = filepath.Join(home, ".protohost", "deployments", projectName)
+		managed = true
 
-		// Clone or pull repository
-		_, err = git.CloneOrPull(cfg.RepoURL, branch, deployDir)
+		// Check out the branch or requested ref
+		depth := cfg.GitDepth
+		if opts.Depth > 0 {
+			depth = opts.Depth
+		}
+		_, err = git.Checkout(git.CheckoutOptions{
+			RepoURL:   cfg.RepoURL,
+			Branch:    branch,
+			Ref:       fetchRef,
+			TargetDir: deployDir,
+			Depth:     depth,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to update repository: %w", err)
 		}
 	}
 
+	hookDir = deployDir
+	hookCtx.DeployDir = deployDir
+
+	// The commit being deployed, recorded once containers are up
+	commit := opts.Commit
+	if commit == "" {
+		commit, _ = git.GetCommit(deployDir)
+	}
+	hookCtx.Commit = commit
+	hookEnv = hooks.Env(cfg, hookCtx)
+
+	// Remember where this deployment lives for down, logs and cleanup
+	if err := reg.UpdateDeployDir(projectName, deployDir, managed); err != nil {
+		fmt.Printf("Warning: failed to record deploy directory: %v\n", err)
+	}
+
+	// Limit services that don't set their own resource limits
+	limits := docker.Limits{CPUs: cfg.DefaultCPULimit, Memory: cfg.DefaultMemoryLimit}
+	if err := docker.ApplyLimits(projectName, deployDir, limits); err != nil {
+		return err
+	}
+
 	// Handle --clean flag
 	if opts.Clean {
 		fmt.Println("🧹 Cleaning existing deployment...")
@@ -107,39 +211,71 @@ func Local(opts LocalOptions) error {
 	}
 
 	// Build containers if requested or if this is a new deployment
-	if opts.Build || isNew {
+	if !opts.SkipBuild && (opts.Build || isNew) {
+		if err := hooks.Execute(hooks.PreBuild, cfg, hookDir, hookEnv); err != nil {
+			return err
+		}
 		if err := docker.Build(projectName, deployDir); err != nil {
 			return err
 		}
+		if err := hooks.Execute(hooks.PostBuild, cfg, hookDir, hookEnv); err != nil {
+			return err
+		}
 	}
 
 	// Start containers
 	env := map[string]string{
-		"WEB_PORT":              fmt.Sprintf("%d", port),
-		"COMPOSE_PROJECT_NAME":  projectName,
-		"NGINX_PROXY_HOST":      cfg.NginxProxyHost,
-		"NGINX_SERVER":          cfg.NginxServer,
-		"REMOTE_HOST":           cfg.RemoteHost,
+		"WEB_PORT":             fmt.Sprintf("%d", port),
+		"COMPOSE_PROJECT_NAME": projectName,
+		"NGINX_PROXY_HOST":     cfg.NginxProxyHost,
+		"NGINX_SERVER":         cfg.NginxServer,
+		"REMOTE_HOST":          cfg.RemoteHost,
 	}
 
 	if err := docker.Up(projectName, deployDir, env); err != nil {
 		return err
 	}
+	rollback = func() {
+		rollbackDeployment(projectName, deployDir, managed, isNew, previous, env)
+	}
 
 	// Update registry status
 	if err := reg.UpdateStatus(projectName, "running"); err != nil {
 		fmt.Printf("Warning: failed to update registry status: %v\n", err)
 	}
 
+	// Record the exact commit deployed, and the ref for non-branch deployments
+	if err := reg.UpdateRevision(projectName, fetchRef, commit); err != nil {
+		fmt.Printf("Warning: failed to record commit: %v\n", err)
+	}
+
+	// Branches that were never pushed (e.g. deployed with --sync) mustn't
+	// look deleted to cleanup --merged
+	if fetchRef == "" && git.HasRemoteBranch(deployDir, branch) {
+		if err := reg.MarkSeenOnRemote(projectName); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	// Published ports are known now that containers are up
+	hookEnv = hooks.Env(cfg, hookCtx)
+
+	// Report whether containers stayed up after starting
+	status := "running"
+	if running, err := docker.IsRunning(projectName); err != nil || !running {
+		status = "not running"
+	}
+	emitter.Emit(events.Event{Type: events.Health, Project: projectName, Branch: branch, Ref: fetchRef, Commit: commit, WebPort: port, Status: status})
+
 	// Execute post-start hook
-	if err := hooks.Execute(hooks.PostStart, cfg.PostStartScript, hookEnv); err != nil {
-		fmt.Printf("Warning: post-start hook failed: %v\n", err)
+	if err := hooks.Execute(hooks.PostStart, cfg, hookDir, hookEnv); err != nil {
+		return err
 	}
 
 	// Execute first-install hook if this is a new deployment
 	if isNew {
-		if err := hooks.Execute(hooks.FirstInstall, cfg.FirstInstallScript, hookEnv); err != nil {
-			fmt.Printf("Warning: first-install hook failed: %v\n", err)
+		if err := hooks.Execute(hooks.FirstInstall, cfg, hookDir, hookEnv); err != nil {
+			return err
 		}
 	}
 
@@ -151,7 +287,7 @@ func Local(opts LocalOptions) error {
 			fmt.Printf("Warning: nginx configuration failed: %v\n", err)
 			fmt.Println("   Deployment is running but not accessible via nginx")
 		} else {
-			fmt.Printf("✅ Nginx configured: https://%s.protohost.xyz\n", projectName)
+			fmt.Printf("✅ Nginx configured: %s\n", nginx.PublicURL(projectName))
 		}
 	}
 
@@ -165,9 +301,35 @@ func Local(opts LocalOptions) error {
 	fmt.Println()
 
 	// Execute post-deploy hook
-	if err := hooks.Execute(hooks.PostDeploy, cfg.PostDeployScript, hookEnv); err != nil {
-		fmt.Printf("Warning: post-deploy hook failed: %v\n", err)
+	if err := hooks.Execute(hooks.PostDeploy, cfg, hookDir, hookEnv); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://localhost:%d", port)
+	if cfg.NginxServer != "" {
+		url = nginx.PublicURL(projectName)
 	}
+	emitter.Emit(events.Event{Type: events.DeploySucceeded, Project: projectName, Branch: branch, Ref: fetchRef, Commit: commit, WebPort: port, URL: url})
 
 	return nil
 }
+
+// markFailedDeployment marks a deployment whose deploy failed as stopped,
+// unless its containers are running (the previous ones, or those restored by
+// a rollback), so it doesn't take up a place in the running quota
+func markFailedDeployment(projectName string) {
+	if running, err := docker.IsRunning(projectName); err == nil && running {
+		return
+	}
+
+	reg, err := registry.New()
+	if err != nil {
+		fmt.Printf("Warning: failed to open registry: %v\n", err)
+		return
+	}
+	defer func() { _ = reg.Close() }()
+
+	if err := reg.UpdateStatus(projectName, "stopped"); err != nil {
+		fmt.Printf("Warning: failed to update registry status: %v\n", err)
+	}
+}
@@ -1,35 +1,57 @@
 package deploy
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/forge"
 	"github.com/thatjpcsguy/protohost/internal/git"
 	"github.com/thatjpcsguy/protohost/internal/hooks"
+	"github.com/thatjpcsguy/protohost/internal/nginx"
+	"github.com/thatjpcsguy/protohost/internal/registry"
 	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
 
 // RemoteOptions contains options for remote deployment
 type RemoteOptions struct {
-	Branch       string
-	Clean        bool
-	Build        bool
+	Branch        string
+	Clean         bool
+	Build         bool
 	AutoBootstrap bool
+	Sync          bool   // Upload the local working tree instead of checking out from git
+	BuildLocal    bool   // Build images locally and ship them instead of building on remote
+	Ref           string // Deploy a specific commit or tag instead of a branch
+	PR            int    // Deploy a pull request instead of a branch
+	Depth         int    // Git fetch depth, overriding GIT_DEPTH
 }
 
 // Remote performs a remote deployment
-func Remote(opts RemoteOptions) error {
+func Remote(opts RemoteOptions) (err error) {
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Detect branch if not specified
+	// Work out what to deploy: a ref or PR, or a branch (detected if not specified)
 	branch := opts.Branch
-	if branch == "" {
+	fetchRef := ""
+	if opts.Ref != "" || opts.PR != 0 {
+		if opts.Sync {
+			return fmt.Errorf("--sync deploys the working tree and cannot be combined with --ref or --pr")
+		}
+		branch, fetchRef, err = resolveRef(cfg, opts.Ref, opts.PR)
+		if err != nil {
+			return err
+		}
+	} else if branch == "" {
 		branch, err = git.GetCurrentBranch()
 		if err != nil {
 			return fmt.Errorf("failed to detect branch: %w", err)
@@ -43,25 +65,29 @@ func Remote(opts RemoteOptions) error {
 	fmt.Println()
 
 	// Execute pre-deploy hook locally
-	hookEnv := map[string]string{
-		"PROJECT_NAME": projectName,
-		"BRANCH":       branch,
-		"REMOTE_HOST":  cfg.RemoteHost,
+	hookCtx := hooks.Context{
+		ProjectName: projectName,
+		Branch:      branch,
+		Ref:         fetchRef,
+		DeployDir:   fmt.Sprintf("%s/%s", cfg.RemoteBaseDir, projectName),
+		Remote:      true,
 	}
-	if err := hooks.Execute(hooks.PreDeploy, cfg.PreDeployScript, hookEnv); err != nil {
-		return fmt.Errorf("pre-deploy hook failed: %w", err)
+	if opts.Sync {
+		hookCtx.Commit, _ = git.GetCommit(".")
+	}
+	if err := hooks.Execute(hooks.PreDeploy, cfg, ".", hooks.Env(cfg, hookCtx)); err != nil {
+		return err
 	}
 
 	// Connect to remote
 	fmt.Printf("🔌 Connecting to %s@%s...\n", cfg.RemoteUser, cfg.RemoteHost)
-	if cfg.RemoteJumpHost != "" {
-		fmt.Printf("   via jump host %s@%s\n", cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	if len(cfg.RemoteJumpHosts) > 0 {
+		fmt.Printf("   via jump host %s\n", cfg.JumpChain())
 	}
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	// Check if protohost is installed on remote
 	installed, err := client.CheckProtohostInstalled()
@@ -92,62 +118,225 @@ Please install protohost on the remote server first:
 		}
 	}
 
-	// Build remote deployment script
-	script := buildRemoteDeployScript(cfg, projectName, branch, opts)
+	// Report progress to the git forge, if configured
+	forgeClient, err := forge.New(cfg, cfg.RepoURL)
+	if err != nil {
+		fmt.Printf("Warning: forge integration disabled: %v\n", err)
+	}
+	var commit string
+	defer func() {
+		if err != nil {
+			if ferr := forgeClient.Failure(commit, projectName, err); ferr != nil {
+				fmt.Printf("Warning: %v\n", ferr)
+			}
+		}
+	}()
 
 	// Execute deployment on remote
 	fmt.Println("🚀 Executing remote deployment...")
 	fmt.Println()
 
-	if err := client.ExecuteInteractive(script); err != nil {
+	if opts.Sync {
+		// Upload the local working tree as-is
+		fmt.Println("📤 Syncing working tree to remote...")
+		if err := syncWorkingTree(client, fmt.Sprintf("%s/%s", cfg.RemoteBaseDir, projectName)); err != nil {
+			return fmt.Errorf("failed to sync working tree: %w", err)
+		}
+	} else {
+		// Check out the branch or ref on remote, using its repository cache
+		if err := client.ExecuteInteractive(buildRemoteCheckoutScript(cfg, projectName, branch, fetchRef, opts)); err != nil {
+			return fmt.Errorf("remote checkout failed: %w", err)
+		}
+	}
+
+	// Find the commit being deployed
+	commit = deployedCommit(client, cfg, projectName, opts)
+	hookCtx.Commit = commit
+	if err := forgeClient.Pending(commit, projectName); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	// Upload env files that aren't tracked in git
+	if err := uploadEnvFiles(client, cfg, projectName); err != nil {
+		return fmt.Errorf("failed to upload env files: %w", err)
+	}
+
+	// Build images here and ship them, so remote doesn't have to
+	if opts.BuildLocal {
+		if err := buildAndShipImages(client, cfg, projectName, commit, opts.Sync); err != nil {
+			return fmt.Errorf("failed to ship images: %w", err)
+		}
+	}
+
+	if err := client.ExecuteInteractive(buildRemoteDeployScript(cfg, projectName, branch, opts)); err != nil {
 		return fmt.Errorf("remote deployment failed: %w", err)
 	}
 
 	fmt.Println()
 	fmt.Println("✅ Remote deployment complete!")
-	fmt.Printf("🌐 URL: https://%s.protohost.xyz\n", projectName)
+	fmt.Printf("🌐 URL: %s\n", nginx.PublicURL(projectName))
 	fmt.Println()
 
-	// Execute post-deploy hook locally
-	if err := hooks.Execute(hooks.PostDeploy, cfg.PostDeployScript, hookEnv); err != nil {
-		fmt.Printf("Warning: post-deploy hook failed: %v\n", err)
+	// Execute post-deploy hook locally, before reporting success, so a
+	// failure isn't reported after the preview was posted as working.
+	// Rollback can't be done from here, so it behaves like abort.
+	if err := hooks.Execute(hooks.PostDeploy, cfg, ".", hooks.Env(cfg, remoteHookContext(client, cfg, hookCtx))); err != nil {
+		return err
+	}
+
+	if err := forgeClient.Success(commit, projectName, nginx.PublicURL(projectName)); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else if commit != "" {
+		fmt.Println("✓ Posted preview URL to the git forge")
 	}
 
 	return nil
 }
 
-// buildRemoteDeployScript builds the bash script to run on remote
-func buildRemoteDeployScript(cfg *config.Config, projectName, branch string, opts RemoteOptions) string {
+// remoteHookContext returns the hook context of the deployment as recorded
+// in the remote registry, so local hooks see its port and expiry. Falls back
+// to what's known locally if the remote can't report it.
+func remoteHookContext(client *ssh.Client, cfg *config.Config, fallback hooks.Context) hooks.Context {
+	alloc, err := RemoteAllocation(client, cfg, fallback.ProjectName)
+	if err != nil {
+		if errors.Is(err, ErrRemoteOutdated) {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		return fallback
+	}
+
+	ctx := hooks.ContextFor(*alloc)
+	ctx.DeployDir = fallback.DeployDir
+	ctx.Remote = true
+	if ctx.Commit == "" {
+		ctx.Commit = fallback.Commit
+	}
+	return ctx
+}
+
+// ErrRemoteOutdated is returned when the protohost installed on the remote
+// server is too old for what's asked of it
+var ErrRemoteOutdated = errors.New("protohost on the remote server is outdated")
+
+// RemoteAllocations returns the registry records of every deployment on the
+// remote server
+func RemoteAllocations(client *ssh.Client, cfg *config.Config) ([]registry.PortAllocation, error) {
+	var stdout, stderr bytes.Buffer
+	command := fmt.Sprintf("cd %s && protohost list --local --json", ssh.QuotePath(cfg.RemoteBaseDir))
+	if err := client.ExecuteStream(command, &stdout, &stderr); err != nil {
+		// Versions before list --json reject the flag
+		if strings.Contains(stderr.String(), "unknown flag: --json") {
+			return nil, fmt.Errorf("%w: it can't list deployments as JSON, update it with 'protohost bootstrap-remote'", ErrRemoteOutdated)
+		}
+		return nil, fmt.Errorf("failed to list remote deployments: %w", err)
+	}
+
+	var allocations []registry.PortAllocation
+	if err := json.Unmarshal(stdout.Bytes(), &allocations); err != nil {
+		return nil, fmt.Errorf("failed to parse remote deployments: %w", err)
+	}
+
+	return allocations, nil
+}
+
+// RemoteAllocation returns the registry record of a deployment on the
+// remote server
+func RemoteAllocation(client *ssh.Client, cfg *config.Config, projectName string) (*registry.PortAllocation, error) {
+	allocations, err := RemoteAllocations(client, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alloc := range allocations {
+		if alloc.ProjectName == projectName {
+			return &alloc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no remote deployment found for %s", projectName)
+}
+
+// deployedCommit returns the full SHA being deployed: the local HEAD for
+// --sync, otherwise the remote checkout's HEAD. Returns "" if unknown.
+func deployedCommit(client *ssh.Client, cfg *config.Config, projectName string, opts RemoteOptions) string {
+	if opts.Sync {
+		commit, _ := git.GetCommit(".")
+		return commit
+	}
+
+	output, err := client.Execute(fmt.Sprintf("cd %s && git rev-parse HEAD", ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName)))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(output)
+}
+
+// buildRemoteCheckoutScript builds the bash script that checks out the
+// branch (or ref, if set) on remote
+func buildRemoteCheckoutScript(cfg *config.Config, projectName, branch, ref string, opts RemoteOptions) string {
 	var script strings.Builder
 
 	script.WriteString("set -e\n\n")
 
 	// Ensure base directory exists
-	script.WriteString(fmt.Sprintf("mkdir -p %s\n", cfg.RemoteBaseDir))
-	script.WriteString(fmt.Sprintf("cd %s\n\n", cfg.RemoteBaseDir))
-
-	// Clone or pull repository
-	script.WriteString(fmt.Sprintf("if [ ! -d %s ]; then\n", projectName))
-	script.WriteString(fmt.Sprintf("    echo '📦 Cloning repository (branch: %s)...'\n", branch))
-	script.WriteString(fmt.Sprintf("    git clone -b %s %s %s\n", branch, cfg.RepoURL, projectName))
-	script.WriteString("else\n")
-	script.WriteString(fmt.Sprintf("    echo '🔄 Updating repository (branch: %s)...'\n", branch))
-	script.WriteString(fmt.Sprintf("    cd %s\n", projectName))
-	script.WriteString("    git fetch origin\n")
-	script.WriteString(fmt.Sprintf("    git reset --hard origin/%s\n", branch))
-	script.WriteString(fmt.Sprintf("    git pull origin %s\n", branch))
-	script.WriteString(fmt.Sprintf("    cd %s\n", cfg.RemoteBaseDir))
-	script.WriteString("fi\n\n")
+	script.WriteString(fmt.Sprintf("mkdir -p %s\n\n", ssh.QuotePath(cfg.RemoteBaseDir)))
+
+	checkoutCmd := fmt.Sprintf("protohost checkout --repo %s --dir %s",
+		ssh.Quote(cfg.RepoURL), ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName))
+	if ref != "" {
+		checkoutCmd += fmt.Sprintf(" --ref %s", ssh.Quote(ref))
+	} else {
+		checkoutCmd += fmt.Sprintf(" --branch %s", ssh.Quote(branch))
+	}
+
+	depth := cfg.GitDepth
+	if opts.Depth > 0 {
+		depth = opts.Depth
+	}
+	if depth > 0 {
+		checkoutCmd += fmt.Sprintf(" --depth %d", depth)
+	}
+
+	script.WriteString(fmt.Sprintf("%s\n", checkoutCmd))
+
+	return script.String()
+}
+
+// buildRemoteDeployScript builds the bash script that runs the deploy on remote
+func buildRemoteDeployScript(cfg *config.Config, projectName, branch string, opts RemoteOptions) string {
+	var script strings.Builder
+
+	script.WriteString("set -e\n\n")
 
 	// Change to project directory
-	script.WriteString(fmt.Sprintf("cd %s/%s\n\n", cfg.RemoteBaseDir, projectName))
+	script.WriteString(fmt.Sprintf("cd %s\n\n", ssh.QuotePath(cfg.RemoteBaseDir+"/"+projectName)))
 
 	// Build protohost deploy command (use --local to avoid recursive remote execution)
-	deployCmd := "protohost deploy --local"
+	// The directory was created by protohost, so cleanup may remove it
+	deployCmd := hooks.RemoteUserPrefix() + "protohost deploy --local --managed"
+	switch {
+	case opts.Ref != "":
+		// Already checked out, so deploy from here and just record the ref
+		deployCmd += fmt.Sprintf(" --ref %s --in-place", ssh.Quote(opts.Ref))
+	case opts.PR != 0:
+		deployCmd += fmt.Sprintf(" --pr %d --in-place", opts.PR)
+	default:
+		deployCmd += fmt.Sprintf(" --branch %s", ssh.Quote(branch))
+	}
+	if opts.Sync {
+		// Synced trees have no .git, so tell the remote to deploy from here
+		// and which commit the working tree was based on
+		deployCmd += " --in-place"
+		if commit, err := git.GetCommit("."); err == nil {
+			deployCmd += fmt.Sprintf(" --commit %s", ssh.Quote(commit))
+		}
+	}
 	if opts.Clean {
 		deployCmd += " --clean"
 	}
-	if opts.Build {
+	if opts.BuildLocal {
+		deployCmd += " --skip-build"
+	} else if opts.Build {
 		deployCmd += " --build"
 	}
 
@@ -157,31 +346,75 @@ func buildRemoteDeployScript(cfg *config.Config, projectName, branch string, opt
 	return script.String()
 }
 
-// bootstrapRemote installs protohost on remote server
+// uploadEnvFiles copies the configured ENV_FILES into the remote deployment
+// directory, preserving their permissions
+func uploadEnvFiles(client *ssh.Client, cfg *config.Config, projectName string) error {
+	for _, envFile := range cfg.EnvFiles {
+		if !fileExists(envFile) {
+			fmt.Printf("Warning: env file %s not found, skipping\n", envFile)
+			continue
+		}
+
+		remotePath := fmt.Sprintf("%s/%s/%s", cfg.RemoteBaseDir, projectName, filepath.ToSlash(envFile))
+		fmt.Printf("📄 Uploading %s...\n", envFile)
+		if err := client.Upload(envFile, remotePath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remotePlatform returns the remote's OS and architecture, named the way Go
+// and Docker name them (e.g. "linux" and "amd64")
+func remotePlatform(client *ssh.Client) (string, string, error) {
+	output, err := client.Execute("uname -s && uname -m")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to detect remote platform: %w", err)
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("unexpected uname output: %q", output)
+	}
+
+	remoteOS := strings.ToLower(fields[0])
+	remoteArch := fields[1]
+	switch remoteArch {
+	case "x86_64":
+		remoteArch = "amd64"
+	case "aarch64", "arm64":
+		remoteArch = "arm64"
+	}
+
+	return remoteOS, remoteArch, nil
+}
+
+// bootstrapRemote installs protohost on remote server by uploading the
+// running binary, if the remote OS and architecture match this machine
 func bootstrapRemote(client *ssh.Client) error {
-	script := `
-set -e
-
-# Detect OS and architecture
-OS=$(uname -s | tr '[:upper:]' '[:lower:]')
-ARCH=$(uname -m)
-case "$ARCH" in
-    x86_64) ARCH="amd64" ;;
-    aarch64|arm64) ARCH="arm64" ;;
-esac
-
-# Download and install protohost
-echo "Installing protohost for $OS/$ARCH..."
-INSTALL_DIR="$HOME/.local/bin"
-mkdir -p "$INSTALL_DIR"
-
-# For now, tell user to install manually
-# TODO: Download from GitHub releases when available
-echo "Please build and install protohost manually on this server"
-exit 1
-`
-
-	return client.ExecuteInteractive(script)
+	remoteOS, remoteArch, err := remotePlatform(client)
+	if err != nil {
+		return err
+	}
+
+	if remoteOS != runtime.GOOS || remoteArch != runtime.GOARCH {
+		return fmt.Errorf("remote is %s/%s but this binary is %s/%s; please build and install protohost manually on the server",
+			remoteOS, remoteArch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate protohost binary: %w", err)
+	}
+
+	fmt.Printf("Installing protohost for %s/%s to ~/.local/bin...\n", remoteOS, remoteArch)
+	if err := client.Upload(binary, "~/.local/bin/protohost"); err != nil {
+		return fmt.Errorf("failed to upload binary: %w", err)
+	}
+
+	fmt.Println("   Make sure ~/.local/bin is on the remote PATH for non-interactive shells")
+	return nil
 }
 
 // BootstrapRemote installs protohost on remote server (command implementation)
@@ -199,14 +432,13 @@ func BootstrapRemote() error {
 	fmt.Printf("🚀 Installing protohost on %s@%s...\n", cfg.RemoteUser, cfg.RemoteHost)
 
 	// Connect to remote
-	if cfg.RemoteJumpHost != "" {
-		fmt.Printf("   via jump host %s@%s\n", cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	if len(cfg.RemoteJumpHosts) > 0 {
+		fmt.Printf("   via jump host %s\n", cfg.JumpChain())
 	}
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.RemoteHost, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	// Check if already installed
 	installed, err := client.CheckProtohostInstalled()
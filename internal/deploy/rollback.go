@@ -0,0 +1,77 @@
+package deploy
+
+import (
+	"fmt"
+
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/registry"
+)
+
+// rollbackDeployment undoes a deployment after a hook failed with
+// on_failure=rollback. A first deployment is removed entirely. Otherwise the
+// previously deployed commit is restored if protohost manages the checkout;
+// if it doesn't, the containers are stopped rather than left running a
+// broken version.
+func rollbackDeployment(projectName, deployDir string, managed, isNew bool, previous *registry.PortAllocation, env map[string]string) {
+	fmt.Println("⏪ Rolling back deployment...")
+
+	reg, err := registry.New()
+	if err != nil {
+		fmt.Printf("Warning: rollback failed to open registry: %v\n", err)
+		return
+	}
+	defer func() { _ = reg.Close() }()
+
+	if isNew {
+		if err := docker.Down(projectName, deployDir, true); err != nil {
+			fmt.Printf("Warning: rollback failed to stop containers: %v\n", err)
+		}
+		if err := reg.ReleasePort(projectName); err != nil {
+			fmt.Printf("Warning: rollback failed to release port: %v\n", err)
+		}
+		fmt.Println("✓ Removed failed first deployment")
+		return
+	}
+
+	if managed && previous != nil && previous.Commit != "" {
+		err := restoreCommit(projectName, deployDir, previous.Commit, env)
+		if err == nil {
+			if err := reg.UpdateRevision(projectName, previous.Ref, previous.Commit); err != nil {
+				fmt.Printf("Warning: failed to record commit: %v\n", err)
+			}
+			fmt.Printf("✓ Restored previous commit %s\n", shortSHA(previous.Commit))
+			return
+		}
+		fmt.Printf("Warning: failed to restore previous commit: %v\n", err)
+	}
+
+	if err := docker.Down(projectName, deployDir, false); err != nil {
+		fmt.Printf("Warning: rollback failed to stop containers: %v\n", err)
+		return
+	}
+	if err := reg.UpdateStatus(projectName, "stopped"); err != nil {
+		fmt.Printf("Warning: failed to update status: %v\n", err)
+	}
+	fmt.Println("✓ Stopped deployment (no previous commit to restore)")
+}
+
+// restoreCommit checks out commit in deployDir and rebuilds and restarts
+// the containers from it
+func restoreCommit(projectName, deployDir, commit string, env map[string]string) error {
+	if err := git.CheckoutDetached(deployDir, commit); err != nil {
+		return err
+	}
+	if err := docker.Build(projectName, deployDir); err != nil {
+		return err
+	}
+	return docker.Up(projectName, deployDir, env)
+}
+
+// shortSHA abbreviates a commit SHA for display
+func shortSHA(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
@@ -0,0 +1,120 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/ssh"
+)
+
+// syncWorkingTree uploads the local working tree (respecting .gitignore) to
+// remoteDir. Files are compared with the remote copies, so only new and
+// changed files are sent even if the remote tree changed since the last
+// sync, and files synced before but since removed locally are deleted.
+func syncWorkingTree(client *ssh.Client, remoteDir string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	files, err := git.ListFiles(cwd)
+	if err != nil {
+		return err
+	}
+
+	// Only the listed files, and the directories leading to them, are synced
+	wanted := make(map[string]bool)
+	for _, file := range files {
+		file = filepath.ToSlash(file)
+		wanted[file] = true
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			wanted[dir] = true
+		}
+	}
+	skip := func(rel string, isDir bool) bool {
+		return !wanted[rel] || rel == git.SyncManifest
+	}
+
+	result, err := client.SyncDir(cwd, remoteDir, skip)
+	if err != nil {
+		return err
+	}
+
+	// Delete files the previous sync uploaded that no longer exist locally
+	// (missing on first sync)
+	removed := 0
+	if content, err := client.ReadFile(remoteDir + "/" + git.SyncManifest); err == nil {
+		previous := parseManifest(string(content))
+		for _, file := range sortedKeys(previous) {
+			if _, ok := result.Files[file]; ok {
+				continue
+			}
+			if err := client.Remove(remoteDir + "/" + file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file, err)
+			}
+			removed++
+		}
+	}
+
+	if err := client.UploadBytes([]byte(formatManifest(result.Files)), remoteDir+"/"+git.SyncManifest, 0644); err != nil {
+		return fmt.Errorf("failed to write sync manifest: %w", err)
+	}
+
+	fmt.Printf("✓ Synced %d file(s): %d uploaded, %d updated, %d removed, %d unchanged\n",
+		len(result.Files), result.Uploaded, result.Updated, removed, result.Unchanged)
+
+	return nil
+}
+
+// parseManifest parses a manifest of synced files ("<mode>  <path>" lines),
+// returning each path's mode. Manifests written by older versions hold
+// hashes in place of modes, which parse with a mode of 0.
+func parseManifest(content string) map[string]os.FileMode {
+	manifest := make(map[string]os.FileMode)
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+		mode, err := strconv.ParseUint(parts[0], 8, 32)
+		if err != nil {
+			mode = 0
+		}
+		if parts[0] == "link" {
+			mode = uint64(os.ModeSymlink | 0777)
+		}
+		manifest[parts[1]] = os.FileMode(mode)
+	}
+	return manifest
+}
+
+// formatManifest renders a manifest of synced files, with the permission
+// bits of each in octal, or "link" for symlinks
+func formatManifest(manifest map[string]os.FileMode) string {
+	var b strings.Builder
+	for _, file := range sortedKeys(manifest) {
+		mode := manifest[file]
+		if mode&os.ModeSymlink != 0 {
+			fmt.Fprintf(&b, "link  %s\n", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%04o  %s\n", mode.Perm(), file)
+	}
+	return b.String()
+}
+
+// sortedKeys returns a map's keys in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,56 @@
+package deploy
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	files := map[string]os.FileMode{
+		"README.md":                0644,
+		".protohost/post-start.sh": 0755,
+		"dir with spaces/file":     0600,
+		"current":                  os.ModeSymlink | 0777,
+	}
+
+	content := formatManifest(files)
+	want := "0755  .protohost/post-start.sh\n" +
+		"0644  README.md\n" +
+		"link  current\n" +
+		"0600  dir with spaces/file\n"
+	if content != want {
+		t.Errorf("formatManifest() =\n%s\nwant\n%s", content, want)
+	}
+
+	if got := parseManifest(content); !reflect.DeepEqual(got, files) {
+		t.Errorf("parseManifest(formatManifest()) = %v, want %v", got, files)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]os.FileMode
+	}{
+		{"empty", "", map[string]os.FileMode{}},
+		{"modes", "0644  a.txt\n0755  bin/run\n", map[string]os.FileMode{"a.txt": 0644, "bin/run": 0755}},
+		{"symlink", "link  current\n", map[string]os.FileMode{"current": os.ModeSymlink | 0777}},
+		{
+			"hashes written by older versions",
+			"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  a.txt\n",
+			map[string]os.FileMode{"a.txt": 0},
+		},
+		{"path with double spaces", "0644  a  b.txt\n", map[string]os.FileMode{"a  b.txt": 0644}},
+		{"malformed lines are skipped", "0644 a.txt\n0644  \n\n0600  ok\n", map[string]os.FileMode{"ok": 0600}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseManifest(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseManifest(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
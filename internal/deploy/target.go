@@ -0,0 +1,51 @@
+package deploy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+var (
+	shaPattern     = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	invalidNameRun = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// resolveRef works out the deployment name and the git ref to fetch when
+// deploying a specific ref or pull request instead of a branch. The name
+// stands in for the branch in the project name (e.g. myapp-pr-42).
+func resolveRef(cfg *config.Config, ref string, pr int) (name, fetchRef string, err error) {
+	if ref != "" && pr != 0 {
+		return "", "", fmt.Errorf("--ref and --pr cannot be used together")
+	}
+
+	if pr != 0 {
+		if pr < 0 {
+			return "", "", fmt.Errorf("invalid pull request number: %d", pr)
+		}
+		fetchRef = strings.ReplaceAll(cfg.PRRefPattern, "{number}", strconv.Itoa(pr))
+		return fmt.Sprintf("pr-%d", pr), fetchRef, nil
+	}
+
+	name = refName(ref)
+	if name == "" {
+		return "", "", fmt.Errorf("ref %q doesn't give a usable deployment name", ref)
+	}
+
+	return name, ref, nil
+}
+
+// refName turns a commit SHA or tag into a name usable in a project name
+func refName(ref string) string {
+	name := strings.ToLower(ref)
+	if shaPattern.MatchString(name) {
+		return name[:7]
+	}
+
+	name = strings.TrimPrefix(name, "refs/tags/")
+	name = invalidNameRun.ReplaceAllString(name, "-")
+	return strings.Trim(name, "-")
+}
@@ -0,0 +1,75 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+func TestRefName(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"4f2a9c1e8b7d6f5a4c3b2a1908f7e6d5c4b3a291", "4f2a9c1"},
+		{"4F2A9C1E", "4f2a9c1"},
+		{"4f2a9c1", "4f2a9c1"},
+		{"v1.2.3", "v1-2-3"},
+		{"refs/tags/Release_2024", "release-2024"},
+		{"feature/new thing", "feature-new-thing"},
+		{"--weird--", "weird"},
+		{"abc123", "abc123"}, // Too short to be a SHA
+		{"deadbeefz", "deadbeefz"},
+		{"@@@", ""},
+	}
+
+	for _, tt := range tests {
+		if got := refName(tt.ref); got != tt.want {
+			t.Errorf("refName(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	cfg := &config.Config{PRRefPattern: "refs/pull/{number}/head"}
+
+	tests := []struct {
+		name      string
+		ref       string
+		pr        int
+		wantName  string
+		wantFetch string
+		wantErr   bool
+	}{
+		{"tag", "v1.2.3", 0, "v1-2-3", "v1.2.3", false},
+		{"commit", "4f2a9c1e8b7d", 0, "4f2a9c1", "4f2a9c1e8b7d", false},
+		{"pull request", "", 42, "pr-42", "refs/pull/42/head", false},
+		{"ref and pull request", "v1", 42, "", "", true},
+		{"negative pull request", "", -1, "", "", true},
+		{"ref without a usable name", "///", 0, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, fetchRef, err := resolveRef(cfg, tt.ref, tt.pr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveRef(%q, %d) = %q, %q, want an error", tt.ref, tt.pr, name, fetchRef)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveRef(%q, %d) error = %v", tt.ref, tt.pr, err)
+			}
+			if name != tt.wantName || fetchRef != tt.wantFetch {
+				t.Errorf("resolveRef(%q, %d) = %q, %q, want %q, %q", tt.ref, tt.pr, name, fetchRef, tt.wantName, tt.wantFetch)
+			}
+		})
+	}
+
+	// Pull request refs follow the configured pattern
+	gitlab := &config.Config{PRRefPattern: "refs/merge-requests/{number}/head"}
+	if _, fetchRef, _ := resolveRef(gitlab, "", 7); fetchRef != "refs/merge-requests/7/head" {
+		t.Errorf("resolveRef with a custom pattern fetched %q", fetchRef)
+	}
+}
@@ -0,0 +1,355 @@
+package deploylog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idFormat names log files, so that they sort by time
+const idFormat = "20060102-150405"
+
+// Each deploy's output goes in <id>.log, and the latest window of its
+// containers' logs in <id>.containers.log, which is replaced each time it's
+// saved. Keeping them apart means saving container logs never touches the
+// output of a deploy that's still running.
+const (
+	logSuffix           = ".log"
+	containerLogsSuffix = ".containers.log"
+)
+
+// Dir returns the directory holding a project's deploy logs
+func Dir(projectName string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".protohost", "logs", projectName), nil
+}
+
+// Log captures everything written to stdout and stderr during a deploy,
+// including the output of commands it runs, into a log file while still
+// showing it. Output goes through a pipe while it's captured, so commands
+// run by the deploy don't see a terminal.
+type Log struct {
+	ID string
+
+	mu     sync.Mutex
+	file   *os.File
+	stdout *os.File
+	stderr *os.File
+	pipes  []*os.File
+	wg     sync.WaitGroup
+}
+
+// Start creates a new log for a deploy of the project and starts capturing
+// output into it until Close
+func Start(projectName string) (*Log, error) {
+	dir, err := Dir(projectName)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// Deploys in the same second get a numbered ID
+	now := time.Now()
+	id := now.Format(idFormat)
+	file, err := os.OpenFile(filepath.Join(dir, id+logSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0644)
+	for n := 2; os.IsExist(err); n++ {
+		id = fmt.Sprintf("%s-%d", now.Format(idFormat), n)
+		file, err = os.OpenFile(filepath.Join(dir, id+logSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file: %w", err)
+	}
+
+	l := &Log{ID: id, file: file, stdout: os.Stdout, stderr: os.Stderr}
+	_, _ = fmt.Fprintf(file, "==> Deploy of %s started at %s\n\n", projectName, now.Format(time.RFC3339))
+
+	stdout, err := l.tee(os.Stdout)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	stderr, err := l.tee(os.Stderr)
+	if err != nil {
+		l.restore()
+		_ = file.Close()
+		return nil, err
+	}
+	os.Stdout, os.Stderr = stdout, stderr
+
+	return l, nil
+}
+
+// tee returns a pipe whose data is copied to both out and the log file
+func (l *Log) tee(out *os.File) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture output: %w", err)
+	}
+	l.pipes = append(l.pipes, w)
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer func() { _ = r.Close() }()
+		_, _ = io.Copy(io.MultiWriter(out, lockedWriter{&l.mu, l.file}), r)
+	}()
+
+	return w, nil
+}
+
+// restore puts back the original stdout and stderr and waits for captured
+// output to be written
+func (l *Log) restore() {
+	os.Stdout, os.Stderr = l.stdout, l.stderr
+	for _, w := range l.pipes {
+		_ = w.Close()
+	}
+	l.wg.Wait()
+}
+
+// Close stops capturing output and records how the deploy ended
+func (l *Log) Close(deployErr error) {
+	l.restore()
+
+	result := "succeeded"
+	if deployErr != nil {
+		result = fmt.Sprintf("failed: %v", deployErr)
+	}
+	_, _ = fmt.Fprintf(l.file, "\n==> Deploy %s at %s\n", result, time.Now().Format(time.RFC3339))
+	_ = l.file.Close()
+}
+
+// lockedWriter serialises writes from the stdout and stderr copies
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// SaveContainerLogs writes the last lines of each of the project's
+// containers' logs alongside its latest deploy log, replacing those saved
+// before. This keeps the evidence when containers are recreated or removed.
+// Nothing is written if there are no containers or lines is 0.
+func SaveContainerLogs(projectName string, lines int) error {
+	if lines <= 0 {
+		return nil
+	}
+
+	cmd := exec.Command("docker", "compose", "-p", projectName, "logs", "--no-color", "--timestamps", "--tail", strconv.Itoa(lines))
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to read container logs: %w", err)
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil
+	}
+
+	dir, err := Dir(projectName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	ids, err := List(projectName)
+	if err != nil {
+		return err
+	}
+	// Deployed before logs were kept
+	id := time.Now().Format(idFormat)
+	if len(ids) > 0 {
+		id = ids[len(ids)-1]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "==> Container logs (last %d lines per container) at %s\n\n", lines, time.Now().Format(time.RFC3339))
+	buf.Write(output)
+	if !bytes.HasSuffix(output, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	// Replace the file in one go, so it's never read half written
+	path := filepath.Join(dir, id+containerLogsSuffix)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write container logs: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write container logs: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the IDs of a project's deploy logs, oldest first
+func List(projectName string) ([]string, error) {
+	dir, err := Dir(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list logs: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return IDs(names), nil
+}
+
+// IDs returns the sorted log IDs among the names of files in a project's log
+// directory
+func IDs(names []string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, name := range names {
+		id, ok := strings.CutSuffix(name, containerLogsSuffix)
+		if !ok {
+			id, ok = strings.CutSuffix(name, logSuffix)
+		}
+		if ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Files returns the names of the files that may hold a log, in the order
+// they're shown: the deploy's output, then its containers' logs
+func Files(id string) []string {
+	return []string{id + logSuffix, id + containerLogsSuffix}
+}
+
+// Paths returns the files of a project's deploy log that exist. id may be
+// "latest".
+func Paths(projectName, id string) ([]string, error) {
+	ids, err := List(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err = Resolve(projectName, ids, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := Dir(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, name := range Files(id) {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
+
+// Resolve checks that id is one of a project's log IDs (sorted, as returned
+// by List), turning "latest" into the newest one
+func Resolve(projectName string, ids []string, id string) (string, error) {
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no deploy logs found for %s", projectName)
+	}
+
+	if id == "latest" {
+		return ids[len(ids)-1], nil
+	}
+	if i := sort.SearchStrings(ids, id); i == len(ids) || ids[i] != id {
+		return "", fmt.Errorf("deploy log %s not found for %s (available: %s)", id, projectName, strings.Join(ids, ", "))
+	}
+
+	return id, nil
+}
+
+// Prune removes deploy logs of every project last written more than days
+// ago, and the directories of projects left without logs. It returns the
+// number of logs removed.
+func Prune(days int) (int, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+
+	root, err := Dir("")
+	if err != nil {
+		return 0, err
+	}
+
+	projects, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to list logs: %w", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	removed := 0
+	for _, project := range projects {
+		if !project.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, project.Name())
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list logs: %w", err)
+		}
+
+		kept := 0
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !strings.HasSuffix(entry.Name(), logSuffix) || info.ModTime().After(cutoff) {
+				kept++
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return removed, fmt.Errorf("failed to remove log: %w", err)
+			}
+			removed++
+		}
+
+		if kept == 0 {
+			_ = os.Remove(dir)
+		}
+	}
+
+	return removed, nil
+}
@@ -1,20 +1,32 @@
 package docker
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Build builds Docker Compose containers
 func Build(projectName, dir string) error {
+	return BuildFor(projectName, dir, "")
+}
+
+// BuildFor builds a project's images for platform (e.g. "linux/amd64"), or
+// for the local daemon's platform if it's empty
+func BuildFor(projectName, dir, platform string) error {
 	fmt.Println("🔨 Building Docker containers...")
 
-	cmd := exec.Command("docker", "compose", "-p", projectName, "build")
-	cmd.Dir = dir
+	cmd := composeCommand(dir, "compose", "-p", projectName, "build")
+	if platform != "" {
+		cmd.Env = append(cmd.Environ(), "DOCKER_DEFAULT_PLATFORM="+platform)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -25,6 +37,80 @@ func Build(projectName, dir string) error {
 	return nil
 }
 
+// BuiltImages returns the image names of services that are built from source
+// (rather than pulled), as Docker Compose would name them for this project
+func BuiltImages(projectName, dir string) ([]string, error) {
+	cmd := composeCommand(dir, "compose", "-p", projectName, "config", "--format", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose config: %w", err)
+	}
+
+	var config struct {
+		Services map[string]struct {
+			Build json.RawMessage `json:"build"`
+			Image string          `json:"image"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(output, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse compose config: %w", err)
+	}
+
+	var images []string
+	for name, service := range config.Services {
+		if len(service.Build) == 0 {
+			continue
+		}
+		image := service.Image
+		if image == "" {
+			image = fmt.Sprintf("%s-%s", projectName, name)
+		}
+		images = append(images, image)
+	}
+	sort.Strings(images)
+
+	return images, nil
+}
+
+// Tag tags an image with a new reference
+func Tag(source, target string) error {
+	cmd := exec.Command("docker", "tag", source, target)
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to tag %s as %s: %w", source, target, err)
+	}
+
+	return nil
+}
+
+// Push pushes an image to its registry
+func Push(image string) error {
+	cmd := exec.Command("docker", "push", image)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to push %s: %w", image, err)
+	}
+
+	return nil
+}
+
+// Save writes a tar archive of the given images to w
+func Save(images []string, w io.Writer) error {
+	args := append([]string{"save"}, images...)
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to save images: %w", err)
+	}
+
+	return nil
+}
+
 // Up starts Docker Compose containers
 func Up(projectName, dir string, env map[string]string) error {
 	fmt.Println("🚀 Starting containers...")
@@ -34,8 +120,7 @@ func Up(projectName, dir string, env map[string]string) error {
 		return err
 	}
 
-	cmd := exec.Command("docker", "compose", "-p", projectName, "up", "-d")
-	cmd.Dir = dir
+	cmd := composeCommand(dir, "compose", "-p", projectName, "up", "-d")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -56,8 +141,7 @@ func Down(projectName, dir string, removeVolumes bool) error {
 		fmt.Println("   Removing volumes...")
 	}
 
-	cmd := exec.Command("docker", args...)
-	cmd.Dir = dir
+	cmd := composeCommand(dir, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -68,21 +152,284 @@ func Down(projectName, dir string, removeVolumes bool) error {
 	return nil
 }
 
-// Logs streams logs from Docker Compose containers
-func Logs(projectName, dir string, follow bool) error {
+// Stop stops a project's containers without removing them
+func Stop(projectName, dir string) error {
+	cmd := composeCommand(dir, "compose", "-p", projectName, "stop")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to stop containers: %w", err)
+	}
+
+	return nil
+}
+
+// Start starts a project's containers again after Stop, with the
+// environment written by Up
+func Start(projectName, dir string) error {
+	cmd := composeCommand(dir, "compose", "-p", projectName, "up", "-d")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to start containers: %w", err)
+	}
+
+	return nil
+}
+
+// LogsOptions selects which logs to show
+type LogsOptions struct {
+	Follow     bool
+	Services   []string // Empty for all services
+	Since      string   // Relative (e.g. 10m) or RFC 3339 timestamp
+	Tail       string   // Number of lines from the end of each log, or "all"
+	Timestamps bool
+}
+
+// LogsArgs returns the docker arguments that show a project's logs
+func LogsArgs(projectName string, opts LogsOptions) []string {
 	args := []string{"compose", "-p", projectName, "logs"}
-	if follow {
+	if opts.Follow {
 		args = append(args, "-f")
 	}
+	if opts.Since != "" {
+		args = append(args, "--since", opts.Since)
+	}
+	if opts.Tail != "" {
+		args = append(args, "--tail", opts.Tail)
+	}
+	if opts.Timestamps {
+		args = append(args, "--timestamps")
+	}
+	return append(args, opts.Services...)
+}
 
-	cmd := exec.Command("docker", args...)
-	cmd.Dir = dir
+// Logs streams logs from Docker Compose containers
+func Logs(projectName, dir string, opts LogsOptions) error {
+	cmd := composeCommand(dir, LogsArgs(projectName, opts)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// Exec runs a command in a service's running container, attached to the
+// terminal. A TTY is only allocated if tty is set.
+func Exec(projectName, dir, service string, tty bool, args ...string) error {
+	composeArgs := []string{"compose", "-p", projectName, "exec"}
+	if !tty {
+		composeArgs = append(composeArgs, "-T")
+	}
+	composeArgs = append(composeArgs, service)
+	composeArgs = append(composeArgs, args...)
+
+	cmd := composeCommand(dir, composeArgs...)
+	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
 	return cmd.Run()
 }
 
+// ServiceRunning checks if a service of the project has a running container
+func ServiceRunning(projectName, dir, service string) (bool, error) {
+	cmd := composeCommand(dir, "compose", "-p", projectName, "ps", "--services", "--status", "running")
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to list running services: %w", err)
+	}
+
+	for _, name := range strings.Fields(string(output)) {
+		if name == service {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ServiceCommand returns a command that runs args inside a service's
+// container, with env set. It uses exec if the service is running and
+// otherwise a one-off container (run --rm), e.g. for hooks that run before
+// the containers are started. No TTY is allocated, so output can be
+// streamed and the command can be fed on stdin.
+//
+// It also returns the name of the one-off container, or "" for exec.
+// Killing the command only stops the docker client, so a one-off container
+// has to be removed with RemoveContainer to stop what runs inside it.
+func ServiceCommand(projectName, dir, service string, env map[string]string, args ...string) (*exec.Cmd, string, error) {
+	running, err := ServiceRunning(projectName, dir, service)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var name string
+	composeArgs := []string{"compose", "-p", projectName}
+	if running {
+		composeArgs = append(composeArgs, "exec", "-T")
+	} else {
+		name = fmt.Sprintf("%s-%s-run-%d", projectName, service, time.Now().UnixNano())
+		composeArgs = append(composeArgs, "run", "--rm", "-T", "--no-deps", "--name", name)
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		composeArgs = append(composeArgs, "-e", fmt.Sprintf("%s=%s", k, env[k]))
+	}
+
+	composeArgs = append(composeArgs, service)
+	composeArgs = append(composeArgs, args...)
+
+	return composeCommand(dir, composeArgs...), name, nil
+}
+
+// RemoveContainer force-removes a container, stopping it if it's running
+func RemoveContainer(name string) error {
+	if err := exec.Command("docker", "rm", "-f", name).Run(); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", name, err)
+	}
+	return nil
+}
+
+// Container is a container of a compose project, as listed by
+// docker compose ps --format json
+type Container struct {
+	ID         string      `json:"ID"`
+	Service    string      `json:"Service"`
+	State      string      `json:"State"`
+	Publishers []Publisher `json:"Publishers"`
+}
+
+// Publisher is a container port and the host port it's published on, if any
+type Publisher struct {
+	URL           string `json:"URL"`
+	TargetPort    int    `json:"TargetPort"`
+	PublishedPort int    `json:"PublishedPort"`
+	Protocol      string `json:"Protocol"`
+}
+
+// ParseContainers parses the output of docker compose ps --format json.
+// Older Compose versions print a JSON array, newer ones a line per container.
+func ParseContainers(output []byte) ([]Container, error) {
+	var containers []Container
+	trimmed := strings.TrimSpace(string(output))
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &containers); err != nil {
+			return nil, fmt.Errorf("failed to parse containers: %w", err)
+		}
+		return containers, nil
+	}
+
+	for _, line := range strings.Split(trimmed, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var c Container
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("failed to parse containers: %w", err)
+		}
+		containers = append(containers, c)
+	}
+
+	return containers, nil
+}
+
+// PublishedPorts returns the host ports published by the project's running
+// containers, keyed by service and container port (e.g. "web:80")
+func PublishedPorts(projectName string) (map[string]int, error) {
+	cmd := exec.Command("docker", "compose", "-p", projectName, "ps", "--format", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	containers, err := ParseContainers(output)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make(map[string]int)
+	for _, c := range containers {
+		for _, p := range c.Publishers {
+			if p.PublishedPort != 0 {
+				ports[fmt.Sprintf("%s:%d", c.Service, p.TargetPort)] = p.PublishedPort
+			}
+		}
+	}
+
+	return ports, nil
+}
+
+// composeCommand returns a docker command that runs in a deployment
+// directory. If resource limits were generated there, COMPOSE_FILE is set in
+// its environment so that Compose applies them on top of the project's own
+// files, without touching the project's .env.
+func composeCommand(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("docker", args...)
+	cmd.Dir = dir
+	if _, err := os.Stat(filepath.Join(dir, LimitsFile)); err == nil {
+		files := strings.Join(ComposeFiles(dir), string(filepath.ListSeparator))
+		cmd.Env = append(os.Environ(), "COMPOSE_FILE="+files)
+	}
+	return cmd
+}
+
+// ComposeFiles returns the absolute paths of the compose files protohost
+// uses in dir: those in COMPOSE_FILE if it's set in the environment or dir's
+// .env file, otherwise the default file and its override, followed by the
+// generated resource limits, if any
+func ComposeFiles(dir string) []string {
+	files := projectComposeFiles(dir)
+	limits := filepath.Join(dir, LimitsFile)
+	if _, err := os.Stat(limits); err == nil && !slices.Contains(files, limits) {
+		files = append(files, limits)
+	}
+	return files
+}
+
+// projectComposeFiles returns the absolute paths of the compose files Docker
+// Compose itself uses in dir
+func projectComposeFiles(dir string) []string {
+	var files []string
+
+	composeFile := os.Getenv("COMPOSE_FILE")
+	if composeFile == "" {
+		composeFile = readEnvFile(dir)["COMPOSE_FILE"]
+	}
+	if composeFile != "" {
+		for _, f := range filepath.SplitList(composeFile) {
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(dir, f)
+			}
+			files = append(files, f)
+		}
+		return files
+	}
+
+	for _, name := range []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		files = append(files, path)
+
+		ext := filepath.Ext(path)
+		override := strings.TrimSuffix(path, ext) + ".override" + ext
+		if _, err := os.Stat(override); err == nil {
+			files = append(files, override)
+		}
+		break
+	}
+
+	return files
+}
+
 // IsRunning checks if containers are running
 func IsRunning(projectName string) (bool, error) {
 	cmd := exec.Command("docker", "compose", "-p", projectName, "ps", "--quiet")
@@ -97,8 +444,7 @@ func IsRunning(projectName string) (bool, error) {
 
 // Status returns the status of containers
 func Status(projectName, dir string) (string, error) {
-	cmd := exec.Command("docker", "compose", "-p", projectName, "ps")
-	cmd.Dir = dir
+	cmd := composeCommand(dir, "compose", "-p", projectName, "ps")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("failed to get status: %w", err)
@@ -107,13 +453,10 @@ func Status(projectName, dir string) (string, error) {
 	return string(output), nil
 }
 
-// writeEnvFile writes environment variables to a .env file
-func writeEnvFile(dir string, env map[string]string) error {
-	envPath := filepath.Join(dir, ".env")
-
-	// Read existing .env if it exists
-	existingVars := make(map[string]string)
-	if content, err := os.ReadFile(envPath); err == nil {
+// readEnvFile returns the variables set in dir's .env file, if any
+func readEnvFile(dir string) map[string]string {
+	vars := make(map[string]string)
+	if content, err := os.ReadFile(filepath.Join(dir, ".env")); err == nil {
 		for _, line := range strings.Split(string(content), "\n") {
 			line = strings.TrimSpace(line)
 			if line == "" || strings.HasPrefix(line, "#") {
@@ -121,10 +464,19 @@ func writeEnvFile(dir string, env map[string]string) error {
 			}
 			parts := strings.SplitN(line, "=", 2)
 			if len(parts) == 2 {
-				existingVars[parts[0]] = parts[1]
+				vars[parts[0]] = parts[1]
 			}
 		}
 	}
+	return vars
+}
+
+// writeEnvFile writes environment variables to a .env file
+func writeEnvFile(dir string, env map[string]string) error {
+	envPath := filepath.Join(dir, ".env")
+
+	// Read existing .env if it exists
+	existingVars := readEnvFile(dir)
 
 	// Merge with new env vars (new vars take precedence)
 	for k, v := range env {
@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestComposeFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string // Created in the deployment directory
+		env   string   // Content of the deployment's .env
+		want  []string
+	}{
+		{
+			name:  "default file",
+			files: []string{"docker-compose.yml"},
+			want:  []string{"docker-compose.yml"},
+		},
+		{
+			name:  "default file with override",
+			files: []string{"compose.yaml", "compose.override.yaml"},
+			want:  []string{"compose.yaml", "compose.override.yaml"},
+		},
+		{
+			name:  "generated limits",
+			files: []string{"compose.yaml", LimitsFile},
+			want:  []string{"compose.yaml", LimitsFile},
+		},
+		{
+			name:  "COMPOSE_FILE in .env",
+			files: []string{"compose.yaml", "compose.prod.yaml"},
+			env:   "COMPOSE_FILE=compose.yaml:compose.prod.yaml\n",
+			want:  []string{"compose.yaml", "compose.prod.yaml"},
+		},
+		{
+			name:  "limits already in COMPOSE_FILE",
+			files: []string{"compose.yaml", LimitsFile},
+			env:   "COMPOSE_FILE=compose.yaml:" + LimitsFile + "\n",
+			want:  []string{"compose.yaml", LimitsFile},
+		},
+		{
+			name: "no compose file",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COMPOSE_FILE", "")
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("services: {}\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.env != "" {
+				if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(tt.env), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var want []string
+			for _, f := range tt.want {
+				want = append(want, filepath.Join(dir, f))
+			}
+			if got := ComposeFiles(dir); !slices.Equal(got, want) {
+				t.Errorf("ComposeFiles() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestComposeCommandUsesLimits(t *testing.T) {
+	t.Setenv("COMPOSE_FILE", "")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd := composeCommand(dir, "compose", "ps"); cmd.Env != nil {
+		t.Errorf("composeCommand() without limits set env %v", cmd.Env)
+	}
+
+	limits := filepath.Join(dir, LimitsFile)
+	if err := os.MkdirAll(filepath.Dir(limits), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(limits, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := composeCommand(dir, "compose", "ps")
+	want := "COMPOSE_FILE=" + filepath.Join(dir, "compose.yaml") + string(filepath.ListSeparator) + limits
+	if !slices.Contains(cmd.Env, want) {
+		t.Errorf("composeCommand() env doesn't contain %q", want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".env")); !os.IsNotExist(err) {
+		t.Errorf("composeCommand() touched .env")
+	}
+}
+
+func TestParseContainers(t *testing.T) {
+	web := Container{
+		ID:      "abc123",
+		Service: "web",
+		State:   "running",
+		Publishers: []Publisher{
+			{URL: "0.0.0.0", TargetPort: 80, PublishedPort: 3000, Protocol: "tcp"},
+		},
+	}
+	db := Container{ID: "def456", Service: "db", State: "exited", Publishers: []Publisher{}}
+
+	tests := []struct {
+		name    string
+		output  string
+		want    []Container
+		wantErr bool
+	}{
+		{
+			name: "array from older Compose",
+			output: `[{"ID":"abc123","Service":"web","State":"running","Publishers":[{"URL":"0.0.0.0","TargetPort":80,"PublishedPort":3000,"Protocol":"tcp"}]},` +
+				`{"ID":"def456","Service":"db","State":"exited","Publishers":[]}]`,
+			want: []Container{web, db},
+		},
+		{
+			name: "line per container from newer Compose",
+			output: `{"ID":"abc123","Service":"web","State":"running","Publishers":[{"URL":"0.0.0.0","TargetPort":80,"PublishedPort":3000,"Protocol":"tcp"}]}` + "\n" +
+				`{"ID":"def456","Service":"db","State":"exited","Publishers":[]}` + "\n",
+			want: []Container{web, db},
+		},
+		{
+			name:   "no containers",
+			output: "\n",
+			want:   nil,
+		},
+		{
+			name:   "empty array",
+			output: "[]\n",
+			want:   []Container{},
+		},
+		{
+			name:    "invalid line",
+			output:  `{"ID":"abc123"}` + "\nnot json\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid array",
+			output:  `[{"ID":"abc123"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseContainers([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContainers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseContainers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
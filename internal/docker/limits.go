@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LimitsFile is the compose override protohost generates in a deployment
+// directory to apply default resource limits
+const LimitsFile = ".protohost/compose.limits.json"
+
+// Limits are default resource limits for the services of a deployment
+type Limits struct {
+	CPUs   string // e.g. "1.5"; empty for no limit
+	Memory string // e.g. "1g"; empty for no limit
+}
+
+// ApplyLimits generates a compose override that limits every service of the
+// project that doesn't set its own limits. The compose commands protohost
+// runs in dir pick it up through ComposeFiles. With no limits, a previously
+// generated override is removed again.
+func ApplyLimits(projectName, dir string, limits Limits) error {
+	path := filepath.Join(dir, LimitsFile)
+
+	// The compose files in use, apart from the generated override
+	var files []string
+	for _, f := range projectComposeFiles(dir) {
+		if f != path {
+			files = append(files, f)
+		}
+	}
+
+	if limits.CPUs == "" && limits.Memory == "" {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove resource limits: %w", err)
+		}
+		return nil
+	}
+
+	args := []string{"compose", "-p", projectName}
+	for _, f := range files {
+		args = append(args, "-f", f)
+	}
+	args = append(args, "config", "--format", "json")
+
+	cmd := exec.Command("docker", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to read compose config: %w", err)
+	}
+
+	var config struct {
+		Services map[string]struct {
+			CPUs     json.RawMessage `json:"cpus"`
+			MemLimit json.RawMessage `json:"mem_limit"`
+			Deploy   struct {
+				Resources struct {
+					Limits struct {
+						CPUs   json.RawMessage `json:"cpus"`
+						Memory json.RawMessage `json:"memory"`
+					} `json:"limits"`
+				} `json:"resources"`
+			} `json:"deploy"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(output, &config); err != nil {
+		return fmt.Errorf("failed to parse compose config: %w", err)
+	}
+
+	names := make([]string, 0, len(config.Services))
+	for name := range config.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Services keep limits they set themselves
+	services := make(map[string]any)
+	for _, name := range names {
+		service := config.Services[name]
+		serviceLimits := make(map[string]string)
+		if limits.CPUs != "" && !isSet(service.CPUs) && !isSet(service.Deploy.Resources.Limits.CPUs) {
+			serviceLimits["cpus"] = limits.CPUs
+		}
+		if limits.Memory != "" && !isSet(service.MemLimit) && !isSet(service.Deploy.Resources.Limits.Memory) {
+			serviceLimits["memory"] = limits.Memory
+		}
+		if len(serviceLimits) > 0 {
+			services[name] = map[string]any{
+				"deploy": map[string]any{"resources": map[string]any{"limits": serviceLimits}},
+			}
+		}
+	}
+
+	content, err := json.MarshalIndent(map[string]any{"services": services}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to generate resource limits: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write resource limits: %w", err)
+	}
+
+	fmt.Printf("📏 Applied default resource limits to %d of %d service(s)\n", len(services), len(names))
+
+	return nil
+}
+
+// isSet reports whether a compose config value is present
+func isSet(value json.RawMessage) bool {
+	v := strings.TrimSpace(string(value))
+	return v != "" && v != "null" && v != "0" && v != `""`
+}
@@ -0,0 +1,217 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// projectLabel is the label Docker Compose puts on a project's containers
+// and volumes
+const projectLabel = "com.docker.compose.project"
+
+// Usage is the resources used by a compose project
+type Usage struct {
+	Containers  int     `json:"containers"`
+	Running     int     `json:"running"`
+	CPUPercent  float64 `json:"cpu_percent"`  // Of one CPU, so may exceed 100
+	MemoryBytes int64   `json:"memory_bytes"` // Of running containers
+	ImageBytes  int64   `json:"image_bytes"`  // Not shared with other images
+	VolumeBytes int64   `json:"volume_bytes"`
+}
+
+// DiskBytes returns the disk space used by the project's images and volumes
+func (u Usage) DiskBytes() int64 {
+	return u.ImageBytes + u.VolumeBytes
+}
+
+// String summarises the usage on one line
+func (u Usage) String() string {
+	return fmt.Sprintf("CPU %.1f%%, memory %s, disk %s (images %s, volumes %s)",
+		u.CPUPercent, HumanSize(u.MemoryBytes), HumanSize(u.DiskBytes()), HumanSize(u.ImageBytes), HumanSize(u.VolumeBytes))
+}
+
+// ProjectsUsage returns the resources used by every compose project on the
+// host, or only by projectName if it's set, keyed by project name, from
+// docker stats and docker system df. Images used by several projects count
+// towards each of them.
+func ProjectsUsage(projectName string) (map[string]*Usage, error) {
+	filter := "label=" + projectLabel
+	if projectName != "" {
+		filter += "=" + projectName
+	}
+
+	output, err := exec.Command("docker", "ps", "-a", "--filter", filter,
+		"--format", `{{.ID}}\t{{.Label "`+projectLabel+`"}}\t{{.Image}}\t{{.State}}`).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	usage := make(map[string]*Usage)
+	projectOf := make(map[string]string)
+	images := make(map[string]map[string]bool)
+	var running []string
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 || fields[1] == "" {
+			continue
+		}
+		id, project, image, state := fields[0], fields[1], fields[2], fields[3]
+
+		u := usage[project]
+		if u == nil {
+			u = &Usage{}
+			usage[project] = u
+			images[project] = make(map[string]bool)
+		}
+		u.Containers++
+		images[project][image] = true
+		projectOf[id] = project
+		if state == "running" {
+			u.Running++
+			running = append(running, id)
+		}
+	}
+
+	// CPU and memory of running containers
+	if len(running) > 0 {
+		args := append([]string{"stats", "--no-stream", "--format", `{{.Container}}\t{{.CPUPerc}}\t{{.MemUsage}}`}, running...)
+		output, err := exec.Command("docker", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read container stats: %w", err)
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) != 3 {
+				continue
+			}
+			u := usage[projectOf[fields[0]]]
+			if u == nil {
+				continue
+			}
+			if cpu, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64); err == nil {
+				u.CPUPercent += cpu
+			}
+			used, _, _ := strings.Cut(fields[2], "/")
+			if mem, err := ParseSize(used); err == nil {
+				u.MemoryBytes += mem
+			}
+		}
+	}
+
+	// Disk used by the projects' images and volumes
+	output, err = exec.Command("docker", "system", "df", "-v", "--format", "{{json .}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disk usage: %w", err)
+	}
+
+	var df struct {
+		Images []struct {
+			ID         string `json:"ID"`
+			Repository string `json:"Repository"`
+			Tag        string `json:"Tag"`
+			UniqueSize string `json:"UniqueSize"`
+		} `json:"Images"`
+		Volumes []struct {
+			Labels string `json:"Labels"`
+			Size   string `json:"Size"`
+		} `json:"Volumes"`
+	}
+	if err := json.Unmarshal(output, &df); err != nil {
+		return nil, fmt.Errorf("failed to parse disk usage: %w", err)
+	}
+
+	for _, image := range df.Images {
+		size, err := ParseSize(image.UniqueSize)
+		if err != nil {
+			continue
+		}
+
+		// Containers refer to images by name, with or without the default
+		// tag, or by (short) ID
+		id := strings.TrimPrefix(image.ID, "sha256:")
+		names := []string{image.Repository + ":" + image.Tag, id, id[:min(12, len(id))]}
+		if image.Tag == "latest" {
+			names = append(names, image.Repository)
+		}
+		for project, used := range images {
+			for _, name := range names {
+				if used[name] {
+					usage[project].ImageBytes += size
+					break
+				}
+			}
+		}
+	}
+
+	for _, volume := range df.Volumes {
+		project := labelValue(volume.Labels, projectLabel)
+		if usage[project] == nil {
+			continue
+		}
+		if size, err := ParseSize(volume.Size); err == nil {
+			usage[project].VolumeBytes += size
+		}
+	}
+
+	return usage, nil
+}
+
+// labelValue returns the value of a label from a comma-separated list of
+// key=value pairs, as printed by the docker CLI
+func labelValue(labels, key string) string {
+	for _, label := range strings.Split(labels, ",") {
+		if k, v, ok := strings.Cut(label, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// sizeUnits are the units the docker CLI prints sizes in: decimal for disk
+// and binary for memory
+var sizeUnits = map[string]float64{
+	"B":  1,
+	"kB": 1e3, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+	"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+}
+
+// ParseSize parses a size printed by the docker CLI (e.g. "1.5GB" or
+// "12.3MiB") into bytes
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(n * unit), nil
+}
+
+// HumanSize formats bytes the way the docker CLI does (e.g. "1.5GB")
+func HumanSize(bytes int64) string {
+	size := float64(bytes)
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	i := 0
+	for size >= 1000 && i < len(units)-1 {
+		size /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	return fmt.Sprintf("%.3g%s", size, units[i])
+}
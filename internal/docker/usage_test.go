@@ -0,0 +1,95 @@
+package docker
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "0B", want: 0},
+		{input: "512B", want: 512},
+		{input: "1.5GB", want: 1500000000},
+		{input: "12kB", want: 12000},
+		{input: "12KB", want: 12000},
+		{input: "12.5MiB", want: 13107200},
+		{input: "2GiB", want: 2 << 30},
+		{input: " 3TB ", want: 3000000000000},
+		{input: "1.5 GB", want: 1500000000},
+		{input: "", wantErr: true},
+		{input: "512", wantErr: true},
+		{input: "GB", wantErr: true},
+		{input: "1.5XB", wantErr: true},
+		{input: "1.2.3MB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{bytes: 0, want: "0B"},
+		{bytes: 999, want: "999B"},
+		{bytes: 1000, want: "1kB"},
+		{bytes: 1500000, want: "1.5MB"},
+		{bytes: 123456789, want: "123MB"},
+		{bytes: 2500000000, want: "2.5GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := HumanSize(tt.bytes); got != tt.want {
+				t.Errorf("HumanSize(%d) = %q, want %q", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumanSizeRoundTrip(t *testing.T) {
+	for _, s := range []string{"1kB", "1.5MB", "250MB", "2.5GB"} {
+		bytes, err := ParseSize(s)
+		if err != nil {
+			t.Fatalf("ParseSize(%q) error = %v", s, err)
+		}
+		if got := HumanSize(bytes); got != s {
+			t.Errorf("HumanSize(ParseSize(%q)) = %q", s, got)
+		}
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	labels := "com.docker.compose.project=app-main,com.docker.compose.service=web,empty="
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: projectLabel, want: "app-main"},
+		{key: "com.docker.compose.service", want: "web"},
+		{key: "empty", want: ""},
+		{key: "missing", want: ""},
+		{key: "com.docker.compose", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := labelValue(labels, tt.key); got != tt.want {
+				t.Errorf("labelValue(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
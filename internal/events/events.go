@@ -0,0 +1,165 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+// Type identifies a lifecycle event
+type Type string
+
+const (
+	DeployStarted   Type = "deploy.started"
+	DeploySucceeded Type = "deploy.succeeded"
+	DeployFailed    Type = "deploy.failed"
+	Down            Type = "down"
+	CleanupRemoved  Type = "cleanup.removed"
+	Health          Type = "health"
+)
+
+// Event is the JSON body posted to lifecycle webhooks
+type Event struct {
+	ID        string    `json:"id"`
+	Type      Type      `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Host      string    `json:"host"`
+	Project   string    `json:"project"`
+	Branch    string    `json:"branch,omitempty"`
+	Ref       string    `json:"ref,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	WebPort   int       `json:"web_port,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Status    string    `json:"status,omitempty"` // Container status for health events ("running", "not running" or "idle")
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Emitter delivers events to the configured webhooks
+type Emitter struct {
+	URLs    []string
+	Secret  string
+	Retries int           // Extra attempts after the first
+	Backoff time.Duration // Delay before the first retry, doubled each time
+	client  *http.Client
+}
+
+// New returns an Emitter for the configured WEBHOOK_URLS, or nil if none
+// are configured. A nil Emitter discards events.
+func New(cfg *config.Config) *Emitter {
+	if cfg == nil || len(cfg.WebhookURLs) == 0 {
+		return nil
+	}
+
+	return &Emitter{
+		URLs:    cfg.WebhookURLs,
+		Secret:  cfg.WebhookSecret,
+		Retries: cfg.WebhookRetries,
+		Backoff: time.Second,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Emit delivers an event to every webhook. Delivery failures are reported
+// as warnings and never fail the operation that emitted the event.
+func (e *Emitter) Emit(event Event) {
+	if e == nil {
+		return
+	}
+
+	event.ID = newID()
+	event.Timestamp = time.Now().UTC()
+	event.Host, _ = os.Hostname()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Warning: failed to encode %s event: %v\n", event.Type, err)
+		return
+	}
+
+	for _, url := range e.URLs {
+		if err := e.deliver(url, event, body); err != nil {
+			fmt.Printf("Warning: failed to deliver %s event to %s: %v\n", event.Type, url, err)
+		}
+	}
+}
+
+// deliver posts body to url, retrying network errors, 429s and 5xx
+// responses with exponential backoff
+func (e *Emitter) deliver(url string, event Event, body []byte) error {
+	delay := e.Backoff
+	var lastErr error
+
+	for attempt := 0; attempt <= e.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		retry, err := e.post(url, event, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+// post makes a single delivery attempt. Returns whether a failure is worth
+// retrying.
+func (e *Emitter) post(url string, event Event, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "protohost")
+	req.Header.Set("X-Protohost-Event", string(event.Type))
+	req.Header.Set("X-Protohost-Delivery", event.ID)
+	if e.Secret != "" {
+		req.Header.Set("X-Protohost-Signature", Sign(e.Secret, body))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret. Receivers should compute
+// the same over the raw request body and compare in constant time.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newID returns a random delivery ID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
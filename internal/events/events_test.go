@@ -0,0 +1,175 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+// delivery is a request received by the test webhook
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhook starts a webhook stand-in that answers with the given status
+// codes in turn, repeating the last one, and records what it receives
+func newWebhook(t *testing.T, statuses ...int) (*httptest.Server, func() []delivery) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []delivery
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, delivery{header: r.Header.Clone(), body: body})
+		status := statuses[min(len(received), len(statuses))-1]
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]delivery(nil), received...)
+	}
+}
+
+// newEmitter returns an Emitter for url with a short backoff
+func newEmitter(t *testing.T, url, secret string, retries int) *Emitter {
+	t.Helper()
+
+	e := New(&config.Config{WebhookURLs: []string{url}, WebhookSecret: secret, WebhookRetries: retries})
+	if e == nil {
+		t.Fatal("New returned nil with a webhook configured")
+	}
+	e.Backoff = 10 * time.Millisecond
+
+	return e
+}
+
+func TestEmitSignsBody(t *testing.T) {
+	server, received := newWebhook(t, http.StatusOK)
+
+	newEmitter(t, server.URL, "s3cret", 0).Emit(Event{Type: DeploySucceeded, Project: "demo-feat", Branch: "feat"})
+
+	deliveries := received()
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(d.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := d.header.Get("X-Protohost-Signature"); got != want {
+		t.Errorf("X-Protohost-Signature = %q, want %q", got, want)
+	}
+
+	var event Event
+	if err := json.Unmarshal(d.body, &event); err != nil {
+		t.Fatalf("body isn't an event: %v", err)
+	}
+	if event.Type != DeploySucceeded || event.Project != "demo-feat" || event.Branch != "feat" {
+		t.Errorf("got event %+v", event)
+	}
+	if event.ID == "" || d.header.Get("X-Protohost-Delivery") != event.ID {
+		t.Errorf("delivery ID %q doesn't match header %q", event.ID, d.header.Get("X-Protohost-Delivery"))
+	}
+	if got := d.header.Get("X-Protohost-Event"); got != string(DeploySucceeded) {
+		t.Errorf("X-Protohost-Event = %q, want %q", got, DeploySucceeded)
+	}
+}
+
+func TestEmitWithoutSecretIsUnsigned(t *testing.T) {
+	server, received := newWebhook(t, http.StatusOK)
+
+	newEmitter(t, server.URL, "", 0).Emit(Event{Type: Down, Project: "demo-feat"})
+
+	deliveries := received()
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	if got := deliveries[0].header.Get("X-Protohost-Signature"); got != "" {
+		t.Errorf("X-Protohost-Signature = %q, want none", got)
+	}
+}
+
+func TestEmitRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		want     int
+	}{
+		{"server error then success", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}, 3, 3},
+		{"too many requests then success", []int{http.StatusTooManyRequests, http.StatusOK}, 3, 2},
+		{"server error gives up after retries", []int{http.StatusServiceUnavailable}, 2, 3},
+		{"client error isn't retried", []int{http.StatusBadRequest}, 3, 1},
+		{"not found isn't retried", []int{http.StatusNotFound}, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newWebhook(t, tt.statuses...)
+
+			newEmitter(t, server.URL, "", tt.retries).Emit(Event{Type: Health, Project: "demo-feat"})
+
+			deliveries := received()
+			if len(deliveries) != tt.want {
+				t.Fatalf("got %d attempts, want %d", len(deliveries), tt.want)
+			}
+
+			// Retries are the same delivery
+			for _, d := range deliveries[1:] {
+				if d.header.Get("X-Protohost-Delivery") != deliveries[0].header.Get("X-Protohost-Delivery") {
+					t.Errorf("retry has a different delivery ID")
+				}
+			}
+		})
+	}
+}
+
+func TestEmitBacksOff(t *testing.T) {
+	server, received := newWebhook(t, http.StatusInternalServerError)
+
+	e := newEmitter(t, server.URL, "", 2)
+	e.Backoff = 50 * time.Millisecond
+
+	start := time.Now()
+	e.Emit(Event{Type: Health, Project: "demo-feat"})
+
+	if got := len(received()); got != 3 {
+		t.Fatalf("got %d attempts, want 3", got)
+	}
+	// 50ms, then 100ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("retries took %v, want at least 150ms of backoff", elapsed)
+	}
+}
+
+func TestNilEmitter(t *testing.T) {
+	if e := New(&config.Config{}); e != nil {
+		t.Fatalf("New without webhooks = %+v, want nil", e)
+	}
+	if e := New(nil); e != nil {
+		t.Fatalf("New(nil) = %+v, want nil", e)
+	}
+
+	// Must not panic
+	var e *Emitter
+	e.Emit(Event{Type: DeployStarted, Project: "demo-feat"})
+}
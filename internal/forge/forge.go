@@ -0,0 +1,338 @@
+package forge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+// Client reports deployments to a GitHub or Gitea compatible REST API
+type Client struct {
+	kind   string // "github" or "gitea"
+	apiURL string
+	token  string
+	owner  string
+	repo   string
+	http   *http.Client
+
+	// Deployment created by Pending, reused by Success and Failure
+	deploymentID int64
+}
+
+// New returns a Client for repoURL, or nil if FORGE_TOKEN isn't set.
+// The forge type and API URL are inferred from repoURL unless FORGE_TYPE
+// and FORGE_URL are set.
+func New(cfg *config.Config, repoURL string) (*Client, error) {
+	if cfg == nil || cfg.ForgeToken == "" {
+		return nil, nil
+	}
+
+	host, owner, repo, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := cfg.ForgeType
+	if kind == "" {
+		kind = "gitea"
+		if host == "github.com" {
+			kind = "github"
+		}
+	}
+
+	apiURL := cfg.ForgeURL
+	if apiURL == "" {
+		switch {
+		case host == "github.com":
+			apiURL = "https://api.github.com"
+		case kind == "github":
+			// GitHub Enterprise Server
+			apiURL = fmt.Sprintf("https://%s/api/v3", host)
+		default:
+			apiURL = fmt.Sprintf("https://%s/api/v1", host)
+		}
+	}
+
+	if kind != "github" && kind != "gitea" {
+		return nil, fmt.Errorf("unknown FORGE_TYPE %q (expected github or gitea)", kind)
+	}
+
+	return &Client{
+		kind:   kind,
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  cfg.ForgeToken,
+		owner:  owner,
+		repo:   repo,
+		http:   &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// parseRepoURL extracts the host, owner and repository name from an SSH
+// (git@host:owner/repo.git) or URL-style repository address
+func parseRepoURL(repoURL string) (host, owner, repo string, err error) {
+	var path string
+
+	if strings.Contains(repoURL, "://") {
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to parse REPO_URL: %w", err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if idx := strings.Index(repoURL, ":"); idx >= 0 {
+		host, path = repoURL[:idx], repoURL[idx+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	idx := strings.LastIndex(path, "/")
+	if host == "" || idx <= 0 {
+		return "", "", "", fmt.Errorf("can't determine owner and repository from REPO_URL %q", repoURL)
+	}
+
+	return host, path[:idx], path[idx+1:], nil
+}
+
+// Pending marks commit as being deployed
+func (c *Client) Pending(commit, projectName string) error {
+	if c == nil || commit == "" {
+		return nil
+	}
+
+	if err := c.setStatus(commit, projectName, "pending", "", "Deploying preview"); err != nil {
+		return err
+	}
+
+	if c.kind == "github" {
+		id, err := c.createDeployment(commit, projectName)
+		if err != nil {
+			return err
+		}
+		c.deploymentID = id
+		return c.setDeploymentStatus(id, "in_progress", "")
+	}
+
+	return nil
+}
+
+// Success marks commit as deployed at previewURL
+func (c *Client) Success(commit, projectName, previewURL string) error {
+	if c == nil || commit == "" {
+		return nil
+	}
+
+	if err := c.setStatus(commit, projectName, "success", previewURL, "Preview deployed"); err != nil {
+		return err
+	}
+
+	if c.kind == "github" {
+		id, err := c.deployment(commit, projectName)
+		if err != nil {
+			return err
+		}
+		return c.setDeploymentStatus(id, "success", previewURL)
+	}
+
+	return nil
+}
+
+// Failure marks the deployment of commit as failed
+func (c *Client) Failure(commit, projectName string, deployErr error) error {
+	if c == nil || commit == "" {
+		return nil
+	}
+
+	description := "Preview deployment failed"
+	if deployErr != nil {
+		description = truncate(fmt.Sprintf("%s: %v", description, deployErr), 140)
+	}
+
+	if err := c.setStatus(commit, projectName, "failure", "", description); err != nil {
+		return err
+	}
+
+	if c.kind == "github" {
+		id, err := c.deployment(commit, projectName)
+		if err != nil {
+			return err
+		}
+		return c.setDeploymentStatus(id, "failure", "")
+	}
+
+	return nil
+}
+
+// Inactive records that the preview for projectName was taken down. The
+// commit status is only updated if commit is known.
+func (c *Client) Inactive(commit, projectName string) error {
+	if c == nil {
+		return nil
+	}
+
+	if commit != "" {
+		if err := c.setStatus(commit, projectName, "success", "", "Preview removed"); err != nil {
+			return err
+		}
+	}
+
+	if c.kind != "github" {
+		return nil
+	}
+
+	var deployments []struct {
+		ID int64 `json:"id"`
+	}
+	query := url.Values{"environment": {environment(projectName)}}
+	if err := c.request(http.MethodGet, c.repoPath("deployments")+"?"+query.Encode(), nil, &deployments); err != nil {
+		return fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	for _, d := range deployments {
+		if err := c.setDeploymentStatus(d.ID, "inactive", ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setStatus sets the commit status for the project's context
+func (c *Client) setStatus(commit, projectName, state, targetURL, description string) error {
+	body := map[string]string{
+		"state":       state,
+		"context":     "protohost/" + projectName,
+		"description": description,
+	}
+	if targetURL != "" {
+		body["target_url"] = targetURL
+	}
+
+	if err := c.request(http.MethodPost, c.repoPath("statuses/"+commit), body, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+
+	return nil
+}
+
+// deployment returns the deployment created by Pending, or creates one
+func (c *Client) deployment(commit, projectName string) (int64, error) {
+	if c.deploymentID != 0 {
+		return c.deploymentID, nil
+	}
+
+	id, err := c.createDeployment(commit, projectName)
+	if err != nil {
+		return 0, err
+	}
+	c.deploymentID = id
+	return id, nil
+}
+
+// createDeployment creates a GitHub deployment of commit to the project's
+// preview environment
+func (c *Client) createDeployment(commit, projectName string) (int64, error) {
+	body := map[string]any{
+		"ref":                    commit,
+		"environment":            environment(projectName),
+		"description":            "Protohost preview",
+		"transient_environment":  true,
+		"production_environment": false,
+		"auto_merge":             false,
+		"required_contexts":      []string{},
+	}
+
+	var deployment struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.request(http.MethodPost, c.repoPath("deployments"), body, &deployment); err != nil {
+		return 0, fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	return deployment.ID, nil
+}
+
+// setDeploymentStatus adds a status to a GitHub deployment
+func (c *Client) setDeploymentStatus(id int64, state, environmentURL string) error {
+	body := map[string]any{"state": state}
+	if environmentURL != "" {
+		body["environment_url"] = environmentURL
+		body["auto_inactive"] = true
+	}
+
+	if err := c.request(http.MethodPost, c.repoPath(fmt.Sprintf("deployments/%d/statuses", id)), body, nil); err != nil {
+		return fmt.Errorf("failed to set deployment status: %w", err)
+	}
+
+	return nil
+}
+
+// repoPath returns the API path of a resource under the repository
+func (c *Client) repoPath(resource string) string {
+	return fmt.Sprintf("/repos/%s/%s/%s", url.PathEscape(c.owner), url.PathEscape(c.repo), resource)
+}
+
+// request sends an authenticated JSON request and decodes the response
+// into out, if non-nil
+func (c *Client) request(method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "protohost")
+	if c.kind == "github" {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else {
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// environment returns the deployment environment name for a project
+func environment(projectName string) string {
+	return "preview/" + projectName
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
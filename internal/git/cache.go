@@ -0,0 +1,231 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var invalidCacheName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SyncManifest is the file deploy --sync writes into the directories it
+// uploads working trees to
+const SyncManifest = ".protohost-sync"
+
+// CheckoutOptions configures Checkout
+type CheckoutOptions struct {
+	RepoURL   string
+	Branch    string // Branch to track; ignored if Ref is set
+	Ref       string // Specific commit, tag or remote ref (e.g. refs/pull/1/head)
+	TargetDir string
+	Depth     int // Fetch depth; 0 fetches full history
+}
+
+// Checkout makes TargetDir a checkout of the requested branch or ref.
+// New checkouts are git worktrees of a bare mirror cached under
+// ~/.protohost/cache, so each deploy only fetches new objects. Full clones
+// created by older versions are updated in place, and directories uploaded
+// by deploy --sync are replaced.
+// Returns true if the checkout was newly created.
+func Checkout(opts CheckoutOptions) (bool, error) {
+	label := "branch: " + opts.Branch
+	if opts.Ref != "" {
+		label = "ref: " + opts.Ref
+	}
+
+	targetDir, err := filepath.Abs(opts.TargetDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve %s: %w", opts.TargetDir, err)
+	}
+
+	// Standalone clone from an older version, a synced working tree, or a
+	// directory we can't use
+	if _, err := os.Stat(targetDir); err == nil {
+		info, err := os.Stat(filepath.Join(targetDir, ".git"))
+		if err != nil {
+			if _, syncErr := os.Stat(filepath.Join(targetDir, SyncManifest)); syncErr != nil {
+				return false, fmt.Errorf("%s exists and is not a git checkout", targetDir)
+			}
+			fmt.Println("🧹 Replacing working tree uploaded by deploy --sync...")
+			if err := os.RemoveAll(targetDir); err != nil {
+				return false, fmt.Errorf("failed to remove synced working tree: %w", err)
+			}
+		} else if info.IsDir() {
+			fmt.Printf("🔄 Updating repository (%s)...\n", label)
+			commit, err := fetchCommit(targetDir, opts)
+			if err != nil {
+				return false, err
+			}
+			if err := checkoutCommit(targetDir, opts, commit); err != nil {
+				return false, err
+			}
+			return false, finishCheckout(targetDir, opts.Depth)
+		}
+	}
+
+	mirror, err := ensureMirror(opts.RepoURL)
+	if err != nil {
+		return false, err
+	}
+
+	commit, err := fetchCommit(mirror, opts)
+	if err != nil {
+		return false, err
+	}
+
+	isNew := false
+	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+		fmt.Printf("📦 Creating checkout (%s)...\n", label)
+
+		// Forget worktrees whose directories were removed by cleanup
+		if err := runGit(mirror, "worktree", "prune"); err != nil {
+			return false, fmt.Errorf("failed to prune worktrees: %w", err)
+		}
+
+		args := []string{"worktree", "add", "--force"}
+		if opts.Ref == "" {
+			args = append(args, "-B", opts.Branch)
+		} else {
+			args = append(args, "--detach")
+		}
+		args = append(args, targetDir, commit)
+
+		if err := runGit(mirror, args...); err != nil {
+			return false, fmt.Errorf("failed to create worktree: %w", err)
+		}
+		isNew = true
+	} else {
+		fmt.Printf("🔄 Updating repository (%s)...\n", label)
+		if err := checkoutCommit(targetDir, opts, commit); err != nil {
+			return false, err
+		}
+	}
+
+	return isNew, finishCheckout(targetDir, opts.Depth)
+}
+
+// ensureMirror returns the bare mirror for repoURL, creating it if needed
+func ensureMirror(repoURL string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	name := strings.Trim(invalidCacheName.ReplaceAllString(repoURL, "-"), "-")
+	mirror := filepath.Join(home, ".protohost", "cache", name+".git")
+
+	if _, err := os.Stat(mirror); os.IsNotExist(err) {
+		fmt.Println("📦 Creating repository cache...")
+		if err := runGit("", "init", "--bare", "--quiet", mirror); err != nil {
+			return "", fmt.Errorf("failed to create repository cache: %w", err)
+		}
+		if err := runGit(mirror, "remote", "add", "origin", repoURL); err != nil {
+			return "", fmt.Errorf("failed to configure repository cache: %w", err)
+		}
+		return mirror, nil
+	}
+
+	// Keep the remote in sync in case REPO_URL changed format (e.g. https → ssh)
+	if err := runGit(mirror, "remote", "set-url", "origin", repoURL); err != nil {
+		return "", fmt.Errorf("failed to configure repository cache: %w", err)
+	}
+
+	return mirror, nil
+}
+
+// fetchCommit fetches the requested branch or ref into dir and returns the
+// commit it points at
+func fetchCommit(dir string, opts CheckoutOptions) (string, error) {
+	args := []string{"fetch"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+
+	if opts.Ref == "" {
+		refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", opts.Branch, opts.Branch)
+		if err := runGit(dir, append(args, "origin", refspec)...); err != nil {
+			return "", fmt.Errorf("failed to fetch branch %s: %w", opts.Branch, err)
+		}
+		return revParse(dir, "refs/remotes/origin/"+opts.Branch)
+	}
+
+	// Fetch the ref explicitly, since commits and PR refs may not be
+	// reachable from the default fetch refspec
+	if err := runGit(dir, append(args, "origin", opts.Ref)...); err == nil {
+		return revParse(dir, "FETCH_HEAD")
+	}
+
+	// Abbreviated SHAs can't be fetched directly, so fetch everything and
+	// resolve the ref locally
+	if err := runGit(dir, "fetch", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return "", fmt.Errorf("failed to fetch: %w", err)
+	}
+	return revParse(dir, opts.Ref+"^{commit}")
+}
+
+// checkoutCommit points an existing checkout at commit, discarding local
+// changes to tracked files
+func checkoutCommit(dir string, opts CheckoutOptions, commit string) error {
+	args := []string{"checkout", "--force", "--quiet"}
+	if opts.Ref == "" {
+		args = append(args, "-B", opts.Branch)
+	} else {
+		args = append(args, "--detach")
+	}
+	args = append(args, commit)
+
+	if err := runGit(dir, args...); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", commit, err)
+	}
+
+	return nil
+}
+
+// finishCheckout initialises submodules and fetches LFS objects if the
+// repository uses them
+func finishCheckout(dir string, depth int) error {
+	if _, err := os.Stat(filepath.Join(dir, ".gitmodules")); err == nil {
+		fmt.Println("📦 Updating submodules...")
+		if err := runGit(dir, "submodule", "sync", "--recursive"); err != nil {
+			return fmt.Errorf("failed to sync submodules: %w", err)
+		}
+
+		args := []string{"submodule", "update", "--init", "--recursive"}
+		if depth > 0 {
+			args = append(args, "--depth", strconv.Itoa(depth))
+		}
+		if err := runGit(dir, args...); err != nil {
+			return fmt.Errorf("failed to update submodules: %w", err)
+		}
+	}
+
+	if attrs, err := os.ReadFile(filepath.Join(dir, ".gitattributes")); err == nil && strings.Contains(string(attrs), "filter=lfs") {
+		if _, err := exec.LookPath("git-lfs"); err != nil {
+			fmt.Println("Warning: repository uses Git LFS but git-lfs is not installed")
+			return nil
+		}
+
+		fmt.Println("📦 Pulling LFS objects...")
+		if err := runGit(dir, "lfs", "pull"); err != nil {
+			return fmt.Errorf("failed to pull LFS objects: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// revParse resolves a revision to a full SHA
+func revParse(dir, rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", rev)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -23,57 +24,126 @@ func GetCurrentBranch() (string, error) {
 	return branch, nil
 }
 
-// CloneOrPull clones a repository or pulls updates if it already exists
-// Returns true if this is a new clone, false if it was an update
-func CloneOrPull(repoURL, branch, targetDir string) (bool, error) {
-	// Check if directory exists
-	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
-		// Clone repository
-		fmt.Printf("📦 Cloning repository (branch: %s)...\n", branch)
-		cmd := exec.Command("git", "clone", "-b", branch, repoURL, targetDir)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return false, fmt.Errorf("failed to clone repository: %w", err)
+// IsGitRepo checks if the current directory is a git repository
+func IsGitRepo() bool {
+	cmd := exec.Command("git", "rev-parse", "--git-dir")
+	return cmd.Run() == nil
+}
+
+// ListFiles returns the files in dir's working tree that aren't ignored,
+// including untracked files, as slash-separated paths relative to dir
+func ListFiles(dir string) ([]string, error) {
+	cmd := exec.Command("git", "ls-files", "--cached", "--others", "--exclude-standard", "-z")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file == "" {
+			continue
 		}
-		return true, nil
+		// Tracked files deleted from the working tree are still listed
+		if _, err := os.Lstat(filepath.Join(dir, file)); err != nil {
+			continue
+		}
+		files = append(files, file)
 	}
 
-	// Pull updates
-	fmt.Printf("🔄 Updating repository (branch: %s)...\n", branch)
+	return files, nil
+}
 
-	// Fetch
-	cmd := exec.Command("git", "fetch", "origin")
-	cmd.Dir = targetDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return false, fmt.Errorf("failed to fetch: %w", err)
+// GetCurrentCommit returns the abbreviated SHA of HEAD
+func GetCurrentCommit() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current commit: %w", err)
 	}
 
-	// Reset to remote branch
-	cmd = exec.Command("git", "reset", "--hard", fmt.Sprintf("origin/%s", branch))
-	cmd.Dir = targetDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return false, fmt.Errorf("failed to reset: %w", err)
+	return strings.TrimSpace(string(output)), nil
+}
+
+// HasRemoteBranch reports whether the repository in dir has a remote-tracking
+// ref for branch, i.e. the branch was pushed or fetched from origin
+func HasRemoteBranch(dir, branch string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+branch)
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+// IsDirty reports whether the working tree in dir has uncommitted changes,
+// including untracked files that aren't ignored
+func IsDirty(dir string) (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to get working tree status: %w", err)
 	}
 
-	// Pull
-	cmd = exec.Command("git", "pull", "origin", branch)
-	cmd.Dir = targetDir
+	return len(strings.TrimSpace(string(output))) > 0, nil
+}
+
+// runGit runs a git command in dir, streaming output to the terminal
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return false, fmt.Errorf("failed to pull: %w", err)
+	return cmd.Run()
+}
+
+// CheckoutDetached checks out commit in dir, discarding local changes to
+// tracked files
+func CheckoutDetached(dir, commit string) error {
+	if err := runGit(dir, "checkout", "--force", "--quiet", "--detach", commit); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", commit, err)
 	}
+	return nil
+}
 
-	return false, nil
+// GetCommit returns the full SHA of HEAD in dir
+func GetCommit(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
 }
 
-// IsGitRepo checks if the current directory is a git repository
-func IsGitRepo() bool {
-	cmd := exec.Command("git", "rev-parse", "--git-dir")
-	return cmd.Run() == nil
+// GetCommitAuthor returns the author of commit in dir as "Name <email>"
+func GetCommitAuthor(dir, commit string) (string, error) {
+	cmd := exec.Command("git", "log", "-1", "--format=%an <%ae>", commit)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit author: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// RemoteBranches returns the set of branch names that exist in a remote repository
+func RemoteBranches(repoURL string) (map[string]bool, error) {
+	cmd := exec.Command("git", "ls-remote", "--heads", repoURL)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches of %s: %w", repoURL, err)
+	}
+
+	branches := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			branches[strings.TrimPrefix(fields[1], "refs/heads/")] = true
+		}
+	}
+
+	return branches, nil
 }
@@ -0,0 +1,182 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/git"
+	"github.com/thatjpcsguy/protohost/internal/nginx"
+	"github.com/thatjpcsguy/protohost/internal/registry"
+)
+
+// UserEnv carries the invoking user through to a remote server, so hooks
+// there see who ran the command rather than the SSH user
+const UserEnv = "PROTOHOST_DEPLOY_USER"
+
+// Context describes the deployment a hook runs for. Fields that aren't known
+// yet (e.g. the port, before it's allocated) are left out of the environment.
+type Context struct {
+	ProjectName  string
+	Branch       string
+	Ref          string
+	Commit       string
+	DeployDir    string
+	WebPort      int
+	ExpiresAt    time.Time
+	FirstInstall *bool // nil if not known
+	Remote       bool  // The deployment is on cfg.RemoteHost, not this machine
+}
+
+// ContextFor returns the Context of a deployment recorded in the registry
+func ContextFor(alloc registry.PortAllocation) Context {
+	return Context{
+		ProjectName: alloc.ProjectName,
+		Branch:      alloc.Branch,
+		Ref:         alloc.Ref,
+		Commit:      alloc.Commit,
+		DeployDir:   alloc.DeployDir,
+		WebPort:     alloc.WebPort,
+		ExpiresAt:   alloc.ExpiresAt,
+	}
+}
+
+// Env returns the environment passed to hooks for a deployment. Every
+// execution path builds it here, so hooks see the same variables whether
+// they run locally, on the remote server or by hand:
+//
+//	PROJECT_NAME, COMPOSE_PROJECT_NAME  Compose project name
+//	BRANCH, REF                         Branch, and ref for --ref/--pr deploys
+//	COMMIT, COMMIT_SHORT, COMMIT_AUTHOR Commit being deployed
+//	DEPLOY_URL, DEPLOY_DIR              Where the deployment is served and runs from
+//	WEB_PORT                            Allocated web port
+//	PORT_<SERVICE>_<PORT>               Host ports published by running containers
+//	EXPIRES_AT                          Expiry time (RFC 3339)
+//	FIRST_INSTALL                       1 on a branch's first deployment, else 0
+//	DEPLOY_USER                         User who ran protohost
+//	COMPOSE_FILES                       Compose files in use, separated by ':'
+//	REMOTE_HOST, NGINX_PROXY_HOST, NGINX_SERVER  From the config
+func Env(cfg *config.Config, ctx Context) map[string]string {
+	env := map[string]string{
+		"PROJECT_NAME":         ctx.ProjectName,
+		"COMPOSE_PROJECT_NAME": ctx.ProjectName,
+		"BRANCH":               ctx.Branch,
+		"DEPLOY_USER":          invokingUser(),
+	}
+
+	if cfg != nil {
+		env["REMOTE_HOST"] = cfg.RemoteHost
+		env["NGINX_PROXY_HOST"] = cfg.NginxProxyHost
+		env["NGINX_SERVER"] = cfg.NginxServer
+	}
+
+	if ctx.Ref != "" {
+		env["REF"] = ctx.Ref
+	}
+
+	if ctx.Commit != "" {
+		env["COMMIT"] = ctx.Commit
+		env["COMMIT_SHORT"] = ctx.Commit
+		if len(ctx.Commit) > 7 {
+			env["COMMIT_SHORT"] = ctx.Commit[:7]
+		}
+
+		// A remote deployment's commit is usually also in the local clone
+		gitDir := ctx.DeployDir
+		if ctx.Remote || gitDir == "" {
+			gitDir = "."
+		}
+		if author, err := git.GetCommitAuthor(gitDir, ctx.Commit); err == nil {
+			env["COMMIT_AUTHOR"] = author
+		}
+	}
+
+	switch {
+	case ctx.Remote || (cfg != nil && cfg.NginxServer != ""):
+		env["DEPLOY_URL"] = nginx.PublicURL(ctx.ProjectName)
+	case ctx.WebPort != 0:
+		env["DEPLOY_URL"] = fmt.Sprintf("http://localhost:%d", ctx.WebPort)
+	}
+
+	if ctx.DeployDir != "" {
+		env["DEPLOY_DIR"] = ctx.DeployDir
+	}
+
+	if ctx.WebPort != 0 {
+		env["WEB_PORT"] = fmt.Sprintf("%d", ctx.WebPort)
+	}
+
+	if !ctx.ExpiresAt.IsZero() {
+		env["EXPIRES_AT"] = ctx.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	if ctx.FirstInstall != nil {
+		env["FIRST_INSTALL"] = "0"
+		if *ctx.FirstInstall {
+			env["FIRST_INSTALL"] = "1"
+		}
+	}
+
+	// Containers and compose files can only be inspected on this machine
+	if !ctx.Remote {
+		if ports, err := docker.PublishedPorts(ctx.ProjectName); err == nil {
+			for key, port := range ports {
+				service, target, _ := strings.Cut(key, ":")
+				env[fmt.Sprintf("PORT_%s_%s", envName(service), target)] = fmt.Sprintf("%d", port)
+			}
+		}
+
+		if ctx.DeployDir != "" {
+			if files := docker.ComposeFiles(ctx.DeployDir); len(files) > 0 {
+				env["COMPOSE_FILES"] = strings.Join(files, string(filepath.ListSeparator))
+			}
+		}
+	}
+
+	return env
+}
+
+// invokingUser returns the user who ran protohost: the one passed on by the
+// machine that started a remote command, or else the current user
+func invokingUser() string {
+	if name := os.Getenv(UserEnv); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// safeUser matches user names that can be put in a remote command unquoted
+var safeUser = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// RemoteUserPrefix returns an environment assignment to put in front of a
+// protohost command run over SSH, so its hooks see the invoking user.
+// Returns "" if the user name isn't safe to pass on unquoted.
+func RemoteUserPrefix() string {
+	name := invokingUser()
+	if !safeUser.MatchString(name) {
+		return ""
+	}
+	return fmt.Sprintf("%s=%s ", UserEnv, name)
+}
+
+// envName turns a compose service name into part of a variable name
+func envName(service string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, service)
+}
@@ -1,10 +1,18 @@
 package hooks
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
 )
 
 // HookType represents the type of hook
@@ -15,50 +23,329 @@ const (
 	PostDeploy   HookType = "post-deploy"
 	PostStart    HookType = "post-start"
 	FirstInstall HookType = "first-install"
+	PreBuild     HookType = "pre-build"
+	PostBuild    HookType = "post-build"
+	PreDown      HookType = "pre-down"
+	PostDown     HookType = "post-down"
+	PreCleanup   HookType = "pre-cleanup"
+	OnFailure    HookType = "on-failure"
+)
+
+// All lists every hook type, in the order they're documented
+var All = []HookType{
+	PreDeploy, PreBuild, PostBuild, PostStart, FirstInstall, PostDeploy,
+	OnFailure, PreDown, PostDown, PreCleanup,
+}
+
+// Parse returns the hook type with the given name
+func Parse(name string) (HookType, bool) {
+	for _, hookType := range All {
+		if string(hookType) == name {
+			return hookType, true
+		}
+	}
+	return "", false
+}
+
+// FailurePolicy decides what happens when a hook fails
+type FailurePolicy string
+
+const (
+	Abort    FailurePolicy = "abort"    // Fail the command
+	Warn     FailurePolicy = "warn"     // Print a warning and carry on
+	Rollback FailurePolicy = "rollback" // Fail the command and undo the deployment
 )
 
-// Execute runs a hook if it exists
-// Priority: file-based hook > script from config
-func Execute(hookType HookType, scriptFromConfig string, env map[string]string) error {
-	// Check for file-based hook first
-	hookPath := filepath.Join(".protohost", "hooks", string(hookType)+".sh")
+// DefaultPolicy returns the failure policy used when none is configured:
+// pre-* hooks abort, so a failed check or backup stops what follows, and
+// everything else warns
+func DefaultPolicy(hookType HookType) FailurePolicy {
+	if strings.HasPrefix(string(hookType), "pre-") {
+		return Abort
+	}
+	return Warn
+}
+
+// FailedError is returned when a hook with an abort or rollback policy fails
+type FailedError struct {
+	Hook   HookType
+	Policy FailurePolicy
+	Err    error
+}
+
+func (e *FailedError) Error() string {
+	return fmt.Sprintf("%s hook failed: %v", e.Hook, e.Err)
+}
+
+func (e *FailedError) Unwrap() error {
+	return e.Err
+}
+
+// IsRollback reports whether err is a hook failure whose policy asks for
+// the deployment to be rolled back
+func IsRollback(err error) bool {
+	var failed *FailedError
+	return errors.As(err, &failed) && failed.Policy == Rollback
+}
+
+// step is one command making up a hook
+type step struct {
+	source  string // Shown in progress output, e.g. "file-based"
+	command func() (*exec.Cmd, func(), error)
+}
+
+// hostCommand returns a step command that runs cmd on the host
+func hostCommand(name string, args ...string) func() (*exec.Cmd, func(), error) {
+	return func() (*exec.Cmd, func(), error) { return exec.Command(name, args...), nil, nil }
+}
+
+// Execute runs a hook if it exists, from dir (the deployment directory)
+// Priority: file-based hooks in dir/.protohost/hooks > script from config
+//
+// File-based hooks are <type>.sh and the executables in <type>.d/, in
+// lexical order, run on the host, followed by any <type>.<service>.sh, run
+// inside that compose service's container. The config script runs on the
+// host, or in the service set by <HOOK>_SERVICE. The hook stops at the
+// first command that fails.
+//
+// The hook is retried and timed out according to its settings in cfg. If it
+// still fails, a warn policy prints a warning and returns nil; abort and
+// rollback return a *FailedError.
+func Execute(hookType HookType, cfg *config.Config, dir string, env map[string]string) error {
+	return ExecuteWithPolicy(hookType, cfg, dir, env, "")
+}
+
+// ExecuteWithPolicy runs a hook like Execute, but handles failures with
+// policy instead of the configured one, unless policy is empty
+func ExecuteWithPolicy(hookType HookType, cfg *config.Config, dir string, env map[string]string, policy FailurePolicy) error {
+	settings := cfg.Hook(string(hookType))
+
+	steps, err := findSteps(hookType, cfg, dir, env)
+	if err != nil {
+		return &FailedError{Hook: hookType, Policy: Abort, Err: err}
+	}
+	if len(steps) == 0 {
+		// No hook defined
+		return nil
+	}
+
+	if policy == "" {
+		policy = FailurePolicy(settings.OnFailure)
+	}
+	if policy == "" {
+		policy = DefaultPolicy(hookType)
+	}
+
+	for _, s := range steps {
+		fmt.Printf("🪝 Running %s hook (%s)...\n", hookType, s.source)
+
+		err = runStep(hookType, s, dir, env, settings)
+		if err == nil {
+			continue
+		}
+
+		// Don't carry on after Ctrl+C
+		if errors.Is(err, errInterrupted) {
+			return &FailedError{Hook: hookType, Policy: Abort, Err: err}
+		}
+
+		if policy == Warn {
+			fmt.Printf("Warning: %s hook failed: %v\n", hookType, err)
+			return nil
+		}
+
+		return &FailedError{Hook: hookType, Policy: policy, Err: err}
+	}
+
+	return nil
+}
+
+// findSteps returns the commands making up a hook, in the order they run
+func findSteps(hookType HookType, cfg *config.Config, dir string, env map[string]string) ([]step, error) {
+	var steps []step
+	projectName := env["PROJECT_NAME"]
+	hooksDir := filepath.Join(dir, ".protohost", "hooks")
+
+	// Check for file-based hooks first
+	hookPath := filepath.Join(hooksDir, string(hookType)+".sh")
 	if _, err := os.Stat(hookPath); err == nil {
-		fmt.Printf("🪝 Running %s hook (file-based)...\n", hookType)
-		return execHookFile(hookPath, env)
+		steps = append(steps, step{
+			source:  "file-based",
+			command: hostCommand("bash", hookPath),
+		})
+	}
+
+	scripts, err := hookDirScripts(filepath.Join(hooksDir, string(hookType)+".d"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range scripts {
+		steps = append(steps, step{
+			source:  fmt.Sprintf("file-based, %s.d/%s", hookType, filepath.Base(path)),
+			command: hostCommand(path),
+		})
+	}
+
+	servicePaths, err := filepath.Glob(filepath.Join(hooksDir, string(hookType)+".*.sh"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(servicePaths)
+	for _, path := range servicePaths {
+		service := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), string(hookType)+"."), ".sh")
+		steps = append(steps, step{
+			source: fmt.Sprintf("file-based, in %s", service),
+			command: func() (*exec.Cmd, func(), error) {
+				return serviceScript(projectName, dir, service, path, env)
+			},
+		})
+	}
+
+	if len(steps) > 0 {
+		return steps, nil
 	}
 
 	// Fallback to script from config
-	if scriptFromConfig != "" {
-		fmt.Printf("🪝 Running %s script (from config)...\n", hookType)
-		return execHookScript(scriptFromConfig, env)
+	script := cfg.HookScript(string(hookType))
+	if script == "" {
+		return nil, nil
 	}
 
-	// No hook defined
-	return nil
+	service := cfg.Hook(string(hookType)).Service
+	if service == "" {
+		return []step{{
+			source:  "from config",
+			command: hostCommand("bash", "-c", script),
+		}}, nil
+	}
+
+	return []step{{
+		source: fmt.Sprintf("from config, in %s", service),
+		command: func() (*exec.Cmd, func(), error) {
+			cmd, container, err := docker.ServiceCommand(projectName, dir, service, env, "sh", "-c", script)
+			return cmd, stopContainer(container), err
+		},
+	}}, nil
 }
 
-// execHookFile executes a hook script file
-func execHookFile(path string, env map[string]string) error {
-	cmd := exec.Command("bash", path)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// hookDirScripts returns the absolute paths of the executables in a
+// <type>.d directory, sorted by name. Hidden files are ignored, and other
+// files that aren't executable are skipped with a warning.
+func hookDirScripts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
 
-	// Set environment variables
-	cmd.Env = os.Environ()
-	for k, v := range env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("hook failed: %w", err)
+	// os.ReadDir returns entries sorted by filename
+	var scripts []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&0111 == 0 {
+			fmt.Printf("Warning: skipping %s, it isn't executable (chmod +x to run it)\n", filepath.Join(dir, entry.Name()))
+			continue
+		}
+
+		scripts = append(scripts, filepath.Join(abs, entry.Name()))
 	}
 
-	return nil
+	return scripts, nil
 }
 
-// execHookScript executes a hook script from config
-func execHookScript(script string, env map[string]string) error {
-	cmd := exec.Command("bash", "-c", script)
+// serviceScript returns a command that runs the script at path inside a
+// service's container. The script is fed on stdin, since the container
+// doesn't necessarily have the deployment directory mounted, to the
+// interpreter named by its shebang line (sh if it has none).
+func serviceScript(projectName, dir, service, path string, env map[string]string) (*exec.Cmd, func(), error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	interpreter := []string{"sh"}
+	if first, _, _ := strings.Cut(string(content), "\n"); strings.HasPrefix(first, "#!") {
+		if fields := strings.Fields(strings.TrimPrefix(first, "#!")); len(fields) > 0 {
+			interpreter = fields
+		}
+	}
+
+	// "-" makes sh, bash, python, perl, node and ruby read the script from stdin
+	cmd, container, err := docker.ServiceCommand(projectName, dir, service, env, append(interpreter, "-")...)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdin = bytes.NewReader(content)
+	return cmd, stopContainer(container), nil
+}
+
+// stopContainer returns a function removing a hook's one-off container
+// after it timed out, or nil if it exec'd into a running container. A hook
+// exec'd into a running container keeps running there after a timeout,
+// since Docker can't stop a single exec'd process.
+func stopContainer(name string) func() {
+	if name == "" {
+		return nil
+	}
+	return func() {
+		if err := docker.RemoveContainer(name); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+}
+
+// runStep runs one step of a hook, retrying it according to settings
+func runStep(hookType HookType, s step, dir string, env map[string]string, settings config.HookSettings) error {
+	var err error
+	attempts := settings.Retries + 1
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			fmt.Printf("🔁 Retrying %s hook (attempt %d/%d)...\n", hookType, attempt, attempts)
+		}
+
+		start := time.Now()
+		err = runCommand(s, dir, env, settings.Timeout)
+		elapsed := time.Since(start).Round(100 * time.Millisecond)
+
+		if err == nil {
+			fmt.Printf("   ✓ %s hook finished in %s\n", hookType, elapsed)
+			return nil
+		}
+		fmt.Printf("   ✗ %s hook failed in %s (%v)\n", hookType, elapsed, err)
+
+		// Don't retry after Ctrl+C
+		if errors.Is(err, errInterrupted) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// runCommand builds a step's command and runs it from dir with env set
+func runCommand(s step, dir string, env map[string]string, timeout time.Duration) error {
+	cmd, stop, err := s.command()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Dir == "" {
+		cmd.Dir = dir
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -68,9 +355,5 @@ func execHookScript(script string, env map[string]string) error {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("hook script failed: %w", err)
-	}
-
-	return nil
+	return run(cmd, timeout, stop)
 }
@@ -0,0 +1,201 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+func TestAllMatchesConfigHookNames(t *testing.T) {
+	if len(All) != len(config.HookNames) {
+		t.Fatalf("hooks.All has %d hooks, config.HookNames has %d", len(All), len(config.HookNames))
+	}
+	for i, hookType := range All {
+		if string(hookType) != config.HookNames[i] {
+			t.Errorf("hooks.All[%d] = %s, config.HookNames[%d] = %s", i, hookType, i, config.HookNames[i])
+		}
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		hook HookType
+		want FailurePolicy
+	}{
+		{PreDeploy, Abort},
+		{PreBuild, Abort},
+		{PreDown, Abort},
+		{PreCleanup, Abort},
+		{PostBuild, Warn},
+		{PostStart, Warn},
+		{FirstInstall, Warn},
+		{PostDeploy, Warn},
+		{PostDown, Warn},
+		{OnFailure, Warn},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultPolicy(tt.hook); got != tt.want {
+			t.Errorf("DefaultPolicy(%s) = %s, want %s", tt.hook, got, tt.want)
+		}
+	}
+}
+
+// failingStep returns a step that fails the first failures times it runs,
+// counting its runs in a file
+func failingStep(t *testing.T, failures int) (step, func() int) {
+	t.Helper()
+
+	counter := filepath.Join(t.TempDir(), "runs")
+	script := fmt.Sprintf(`echo x >> %q; [ "$(wc -l < %q)" -gt %d ]`, counter, counter, failures)
+
+	return step{source: "test", command: hostCommand("sh", "-c", script)}, func() int {
+		content, _ := os.ReadFile(counter)
+		return strings.Count(string(content), "\n")
+	}
+}
+
+func TestRunStepRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		wantErr  bool
+		wantRuns int
+	}{
+		{"succeeds first time", 0, 2, false, 1},
+		{"succeeds on retry", 2, 2, false, 3},
+		{"fails after retries", 3, 2, true, 3},
+		{"no retries", 1, 0, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, runs := failingStep(t, tt.failures)
+
+			err := runStep(PostStart, s, t.TempDir(), nil, config.HookSettings{Retries: tt.retries})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runStep() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := runs(); got != tt.wantRuns {
+				t.Errorf("ran %d times, want %d", got, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestRunStepTimeout(t *testing.T) {
+	s := step{source: "test", command: hostCommand("sleep", "10")}
+
+	start := time.Now()
+	err := runStep(PostStart, s, t.TempDir(), nil, config.HookSettings{Timeout: 100 * time.Millisecond, Retries: 1})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("runStep() error = %v, want a timeout", err)
+	}
+	// Both attempts time out, long before sleep would finish
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runStep() took %v", elapsed)
+	}
+}
+
+func TestRunStepStopsAfterTimeout(t *testing.T) {
+	stopped := false
+	s := step{source: "test", command: func() (*exec.Cmd, func(), error) {
+		return exec.Command("sleep", "10"), func() { stopped = true }, nil
+	}}
+
+	if err := runStep(PostStart, s, t.TempDir(), nil, config.HookSettings{Timeout: 50 * time.Millisecond}); err == nil {
+		t.Fatal("runStep() succeeded, want a timeout")
+	}
+	if !stopped {
+		t.Error("stop wasn't called after the timeout")
+	}
+}
+
+func TestExecuteWithPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		hook         HookType
+		onFailure    string
+		policy       FailurePolicy
+		wantErr      bool
+		wantRollback bool
+	}{
+		{"post hook warns by default", PostStart, "", "", false, false},
+		{"pre hook aborts by default", PreDeploy, "", "", true, false},
+		{"configured warn", PreDeploy, "warn", "", false, false},
+		{"configured rollback", PostStart, "rollback", "", true, true},
+		{"explicit policy overrides config", PostStart, "warn", Abort, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				PreDeployScript: "exit 3",
+				PostStartScript: "exit 3",
+				HookSettings:    map[string]config.HookSettings{string(tt.hook): {OnFailure: tt.onFailure}},
+			}
+
+			err := ExecuteWithPolicy(tt.hook, cfg, t.TempDir(), nil, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExecuteWithPolicy() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := IsRollback(err); got != tt.wantRollback {
+				t.Errorf("IsRollback() = %v, want %v", got, tt.wantRollback)
+			}
+			if err != nil && !strings.Contains(err.Error(), "exit code 3") {
+				t.Errorf("error %q doesn't give the exit code", err)
+			}
+		})
+	}
+}
+
+func TestExecuteWithoutHook(t *testing.T) {
+	if err := Execute(PreDeploy, &config.Config{}, t.TempDir(), nil); err != nil {
+		t.Errorf("Execute() without a hook = %v, want nil", err)
+	}
+}
+
+func TestExecuteRunsHookFilesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	hooksDir := filepath.Join(dir, ".protohost", "hooks")
+	log := filepath.Join(dir, "order")
+
+	writeHook := func(name string, mode os.FileMode) {
+		t.Helper()
+		path := filepath.Join(hooksDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf("#!/bin/sh\necho %s >> %q\n", filepath.Base(name), log)
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeHook("post-start.sh", 0644)
+	writeHook("post-start.d/20-second", 0755)
+	writeHook("post-start.d/10-first", 0755)
+	writeHook("post-start.d/30-not-executable", 0644)
+
+	// The config script is only a fallback
+	cfg := &config.Config{PostStartScript: "echo config >> " + log}
+
+	if err := Execute(PostStart, cfg, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "post-start.sh\n10-first\n20-second\n"
+	if string(content) != want {
+		t.Errorf("hooks ran as\n%s\nwant\n%s", content, want)
+	}
+}
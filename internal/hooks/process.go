@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// killGrace is how long a timed out hook gets to exit after SIGTERM before
+// it's killed
+const killGrace = 5 * time.Second
+
+// errInterrupted is returned by run when the hook was interrupted by the user
+var errInterrupted = errors.New("interrupted")
+
+// run starts cmd in its own process group and waits for it, killing the
+// whole group if it runs longer than timeout (0 for no limit). Interrupts
+// received meanwhile are forwarded to the group, since it no longer shares
+// the terminal's foreground process group. After a timeout, stop (if not
+// nil) is called to stop anything the command left running elsewhere.
+func run(cmd *exec.Cmd, timeout time.Duration, stop func()) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pgid := cmd.Process.Pid
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	interrupted := false
+	for {
+		select {
+		case err := <-done:
+			if interrupted {
+				return errInterrupted
+			}
+			return exitError(err)
+		case sig := <-signals:
+			interrupted = true
+			_ = syscall.Kill(-pgid, sig.(syscall.Signal))
+		case <-deadline:
+			_ = syscall.Kill(-pgid, syscall.SIGTERM)
+			select {
+			case <-done:
+			case <-time.After(killGrace):
+				_ = syscall.Kill(-pgid, syscall.SIGKILL)
+				<-done
+			}
+			if stop != nil {
+				stop()
+			}
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+}
+
+// exitError describes a failed process by its exit code
+func exitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return fmt.Errorf("exit code %d", exitErr.ExitCode())
+	}
+	return err
+}
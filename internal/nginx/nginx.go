@@ -8,14 +8,25 @@ import (
 	"github.com/thatjpcsguy/protohost/internal/ssh"
 )
 
+// PublicURL returns the URL a deployment is served at through nginx
+func PublicURL(projectName string) string {
+	return fmt.Sprintf("https://%s.protohost.xyz", projectName)
+}
+
 // GenerateConfig generates an nginx configuration for a deployment
 func GenerateConfig(cfg *config.Config, projectName string, port int) string {
 	// Always use protohost.xyz as the public domain
 	publicDomain := "protohost.xyz"
 	serverName := fmt.Sprintf("%s.%s", projectName, publicDomain)
 
-	// Use internal IP for proxy pass
+	// Use internal IP for proxy pass, through the protohost proxy if it's
+	// enabled, which tells deployments apart by the X-Protohost-Project header
 	proxyPass := fmt.Sprintf("http://%s:%d", cfg.NginxProxyHost, port)
+	projectHeader := ""
+	if cfg.ProxyPort > 0 {
+		proxyPass = fmt.Sprintf("http://%s:%d", cfg.NginxProxyHost, cfg.ProxyPort)
+		projectHeader = fmt.Sprintf("\n        proxy_set_header X-Protohost-Project %s;", projectName)
+	}
 
 	sslCert := ""
 	sslKey := ""
@@ -45,12 +56,12 @@ func GenerateConfig(cfg *config.Config, projectName string, port int) string {
         proxy_set_header Host $host;
         proxy_set_header X-Real-IP $remote_addr;
         proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
-        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header X-Forwarded-Proto $scheme;%s
         proxy_read_timeout 86400;
         proxy_buffering off;
     }
 }
-`, serverName, sslCert, sslKey, proxyPass)
+`, serverName, sslCert, sslKey, proxyPass, projectHeader)
 
 	return config
 }
@@ -61,19 +72,17 @@ func Deploy(cfg *config.Config, projectName string, configContent string) error
 		return fmt.Errorf("NGINX_SERVER not configured")
 	}
 
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.NginxServer, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.NginxServer, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect to nginx server: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	configFilename := fmt.Sprintf("protohost-%s.conf", projectName)
 	tmpPath := fmt.Sprintf("/tmp/%s", configFilename)
 	finalPath := fmt.Sprintf("/etc/nginx/sites-enabled/%s", configFilename)
 
-	// Write config to temp file
-	writeCmd := fmt.Sprintf("cat > %s << 'NGINX_CONFIG_EOF'\n%s\nNGINX_CONFIG_EOF", tmpPath, configContent)
-	if _, err := client.Execute(writeCmd); err != nil {
+	// Upload config to temp file
+	if err := client.UploadBytes([]byte(configContent), tmpPath, 0644); err != nil {
 		return fmt.Errorf("failed to write config to temp file: %w", err)
 	}
 
@@ -86,6 +95,38 @@ func Deploy(cfg *config.Config, projectName string, configContent string) error
 	return nil
 }
 
+// Refresh installs the nginx configuration for a deployment only if it
+// differs from what's on the server, reloading nginx when it changes.
+// Returns true if the configuration was updated.
+func Refresh(cfg *config.Config, projectName string, configContent string) (bool, error) {
+	if cfg.NginxServer == "" {
+		return false, nil
+	}
+
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.NginxServer, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to nginx server: %w", err)
+	}
+
+	configFilename := fmt.Sprintf("protohost-%s.conf", projectName)
+	tmpPath := fmt.Sprintf("/tmp/%s", configFilename)
+	finalPath := fmt.Sprintf("/etc/nginx/sites-enabled/%s", configFilename)
+
+	if err := client.UploadBytes([]byte(configContent), tmpPath, 0644); err != nil {
+		return false, fmt.Errorf("failed to write config to temp file: %w", err)
+	}
+
+	refreshCmd := fmt.Sprintf(
+		"if sudo cmp -s %s %s; then rm -f %s; else sudo mv %s %s && sudo nginx -t && sudo service nginx reload && echo updated; fi",
+		tmpPath, finalPath, tmpPath, tmpPath, finalPath)
+	output, err := client.Execute(refreshCmd)
+	if err != nil {
+		return false, fmt.Errorf("failed to refresh nginx config: %w", err)
+	}
+
+	return strings.TrimSpace(output) == "updated", nil
+}
+
 // Remove removes nginx configuration from the remote nginx server
 func Remove(cfg *config.Config, projectName string) error {
 	if cfg.NginxServer == "" {
@@ -93,11 +134,10 @@ func Remove(cfg *config.Config, projectName string) error {
 		return nil
 	}
 
-	client, err := ssh.NewClient(cfg.RemoteUser, cfg.NginxServer, cfg.SSHKeyPath, cfg.RemoteJumpUser, cfg.RemoteJumpHost)
+	client, err := ssh.Connect(cfg.RemoteUser, cfg.NginxServer, cfg.SSHKeyPath, cfg.RemoteJumpHosts)
 	if err != nil {
 		return fmt.Errorf("failed to connect to nginx server: %w", err)
 	}
-	defer func() { _ = client.Close() }()
 
 	configFilename := fmt.Sprintf("protohost-%s.conf", projectName)
 	finalPath := fmt.Sprintf("/etc/nginx/sites-enabled/%s", configFilename)
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/nginx"
+	"github.com/thatjpcsguy/protohost/internal/registry"
+)
+
+// Event identifies why a notification was sent
+type Event string
+
+const (
+	ExpiryWarning Event = "expiry_warning"
+	Removed       Event = "removed"
+)
+
+// Notifier posts deployment notifications to a webhook
+type Notifier struct {
+	URL    string
+	Format string // "generic" or "slack"
+	client *http.Client
+}
+
+// New returns a Notifier for the configured expiry webhook, or nil if none
+// is configured
+func New(cfg *config.Config) *Notifier {
+	if cfg == nil || cfg.ExpiryWebhookURL == "" {
+		return nil
+	}
+
+	return &Notifier{
+		URL:    cfg.ExpiryWebhookURL,
+		Format: cfg.ExpiryWebhookFormat,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// payload is the body sent in the generic format
+type payload struct {
+	Event     Event     `json:"event"`
+	Message   string    `json:"message"`
+	Project   string    `json:"project"`
+	Branch    string    `json:"branch"`
+	Ref       string    `json:"ref,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	RepoURL   string    `json:"repo_url,omitempty"`
+	URL       string    `json:"url"`
+	WebPort   int       `json:"web_port"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExpiryWarning announces that a deployment will be removed soon
+func (n *Notifier) ExpiryWarning(alloc registry.PortAllocation) error {
+	hours := int(math.Ceil(time.Until(alloc.ExpiresAt).Hours()))
+	message := fmt.Sprintf("Preview %s expires in %d hour(s) (at %s). Redeploy to keep it.",
+		alloc.ProjectName, hours, alloc.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	return n.send(ExpiryWarning, alloc, message)
+}
+
+// Removed announces that a deployment was torn down by cleanup
+func (n *Notifier) Removed(alloc registry.PortAllocation, reason string) error {
+	message := fmt.Sprintf("Preview %s was removed (%s).", alloc.ProjectName, reason)
+	return n.send(Removed, alloc, message)
+}
+
+// send posts a notification in the configured format
+func (n *Notifier) send(event Event, alloc registry.PortAllocation, message string) error {
+	var body any
+	switch n.Format {
+	case "slack":
+		body = map[string]string{
+			"text": fmt.Sprintf("%s\n<%s|%s>", message, nginx.PublicURL(alloc.ProjectName), alloc.ProjectName),
+		}
+	case "", "generic":
+		body = payload{
+			Event:     event,
+			Message:   message,
+			Project:   alloc.ProjectName,
+			Branch:    alloc.Branch,
+			Ref:       alloc.Ref,
+			Commit:    alloc.Commit,
+			RepoURL:   alloc.RepoURL,
+			URL:       nginx.PublicURL(alloc.ProjectName),
+			WebPort:   alloc.WebPort,
+			Status:    alloc.Status,
+			CreatedAt: alloc.CreatedAt,
+			ExpiresAt: alloc.ExpiresAt,
+		}
+	default:
+		return fmt.Errorf("unknown EXPIRY_WEBHOOK_FORMAT %q (expected generic or slack)", n.Format)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	resp, err := n.client.Post(n.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+	"github.com/thatjpcsguy/protohost/internal/docker"
+	"github.com/thatjpcsguy/protohost/internal/events"
+	"github.com/thatjpcsguy/protohost/internal/registry"
+)
+
+// ProjectHeader is set by nginx to the deployment a request is for
+const ProjectHeader = "X-Protohost-Project"
+
+// HealthPath answers requests without ProjectHeader, so it can be checked
+// whether the proxy is up to wake deployments before any are stopped
+const HealthPath = "/_protohost/health"
+
+// touchInterval limits how often a deployment's activity is written to the
+// registry
+const touchInterval = time.Minute
+
+// wakeGrace is how long after a deployment is started that failed
+// connections to it show the starting page rather than an error, while the
+// app boots
+const wakeGrace = 2 * time.Minute
+
+// Server proxies requests to deployments, recording when each was last
+// requested, and starts idle deployments when they're requested
+type Server struct {
+	reg        *registry.Registry
+	maxRunning int // Running deployments allowed on the host (0 for no limit)
+
+	mu      sync.Mutex
+	touched map[string]time.Time
+	waking  map[string]bool
+	woken   map[string]time.Time
+	wakeErr map[string]error
+}
+
+// New returns a Server using the registry to find deployments
+func New(reg *registry.Registry, maxRunning int) *Server {
+	return &Server{
+		reg:        reg,
+		maxRunning: maxRunning,
+		touched:    make(map[string]time.Time),
+		waking:     make(map[string]bool),
+		woken:      make(map[string]time.Time),
+		wakeErr:    make(map[string]error),
+	}
+}
+
+// Addr returns the address the proxy listens on by default: port on the
+// interface host (NGINX_PROXY_HOST, where nginx reaches this machine)
+// resolves to, or on localhost if host is empty. Anything that can connect
+// to the proxy can reach every deployment, so it mustn't listen on all
+// interfaces unless a firewall keeps others out.
+func Addr(host string, port int) (string, error) {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	if net.ParseIP(host) == nil {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		if len(addrs) == 0 {
+			return "", fmt.Errorf("failed to resolve %s: no addresses", host)
+		}
+		host = addrs[0]
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// ServeHTTP proxies a request to the deployment named by ProjectHeader
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	projectName := r.Header.Get(ProjectHeader)
+	if projectName == "" && r.URL.Path == HealthPath {
+		s.health(w)
+		return
+	}
+	if projectName == "" {
+		http.Error(w, "Missing "+ProjectHeader+" header", http.StatusBadRequest)
+		return
+	}
+	r.Header.Del(ProjectHeader)
+
+	alloc, err := s.reg.GetAllocation(projectName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("No deployment named %s", projectName), http.StatusNotFound)
+		return
+	}
+
+	s.touch(projectName)
+
+	switch alloc.Status {
+	case "running":
+	case "idle":
+		s.wake(*alloc)
+		s.startingPage(w, projectName)
+		return
+	default:
+		http.Error(w, fmt.Sprintf("%s is %s", projectName, alloc.Status), http.StatusServiceUnavailable)
+		return
+	}
+
+	target := net.JoinHostPort("127.0.0.1", strconv.Itoa(alloc.WebPort))
+	proxy := &httputil.ReverseProxy{
+		// Keep the Host and X-Forwarded-* headers set by nginx
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = target
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.mu.Lock()
+			booting := time.Since(s.woken[projectName]) < wakeGrace
+			s.mu.Unlock()
+			if booting {
+				s.startingPage(w, projectName)
+				return
+			}
+			http.Error(w, fmt.Sprintf("%s isn't responding: %v", projectName, err), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// health reports whether the proxy can serve requests, which needs the
+// registry
+func (s *Server) health(w http.ResponseWriter) {
+	if _, err := s.reg.CountRunning(""); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// Healthy checks that the proxy listening on addr is up
+func Healthy(addr string) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + HealthPath)
+	if err != nil {
+		return fmt.Errorf("proxy isn't reachable: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy isn't healthy: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// touch records a request for the deployment, at most once per
+// touchInterval
+func (s *Server) touch(projectName string) {
+	s.mu.Lock()
+	if time.Since(s.touched[projectName]) < touchInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.touched[projectName] = time.Now()
+	s.mu.Unlock()
+
+	if err := s.reg.TouchActivity(projectName); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// wake starts an idle deployment in the background, unless it's already
+// starting or the host runs as many deployments as it may
+func (s *Server) wake(alloc registry.PortAllocation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.waking[alloc.ProjectName] {
+		return
+	}
+
+	// Deployments still starting aren't running in the registry yet, but
+	// count towards the limit
+	if s.maxRunning > 0 {
+		running, err := s.reg.CountRunning(alloc.ProjectName)
+		if err != nil {
+			s.wakeErr[alloc.ProjectName] = err
+			return
+		}
+		running += len(s.waking)
+		if running >= s.maxRunning {
+			s.wakeErr[alloc.ProjectName] = fmt.Errorf("%d of %d allowed deployments are already running", running, s.maxRunning)
+			return
+		}
+	}
+
+	s.waking[alloc.ProjectName] = true
+	delete(s.wakeErr, alloc.ProjectName)
+
+	go func() {
+		fmt.Printf("⏰ Waking %s\n", alloc.ProjectName)
+		err := docker.Start(alloc.ProjectName, alloc.DeployDir)
+
+		// Mark it running and no longer waking at once, so that wake never
+		// counts it twice against the limit
+		s.mu.Lock()
+		if err == nil {
+			err = s.reg.UpdateStatus(alloc.ProjectName, "running")
+		}
+		delete(s.waking, alloc.ProjectName)
+		if err != nil {
+			s.wakeErr[alloc.ProjectName] = err
+		} else {
+			s.woken[alloc.ProjectName] = time.Now()
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("Warning: failed to wake %s: %v\n", alloc.ProjectName, err)
+			return
+		}
+		fmt.Printf("✓ Woke %s\n", alloc.ProjectName)
+
+		if cfg, err := config.LoadDir(alloc.DeployDir); err == nil {
+			events.New(cfg).Emit(events.Event{
+				Type:    events.Health,
+				Project: alloc.ProjectName,
+				Branch:  alloc.Branch,
+				Ref:     alloc.Ref,
+				Commit:  alloc.Commit,
+				WebPort: alloc.WebPort,
+				Status:  "running",
+				Reason:  "woken by request",
+			})
+		}
+	}()
+}
+
+// startingPage tells the visitor the deployment is starting, refreshing
+// until it's up, or why it couldn't be started
+func (s *Server) startingPage(w http.ResponseWriter, projectName string) {
+	s.mu.Lock()
+	wakeErr := s.wakeErr[projectName]
+	s.mu.Unlock()
+
+	name := html.EscapeString(projectName)
+	title := fmt.Sprintf("Starting %s…", name)
+	message := "This preview was stopped while idle. The page will reload once it's up."
+	refresh := `<meta http-equiv="refresh" content="3">`
+	if wakeErr != nil {
+		title = fmt.Sprintf("Couldn't start %s", name)
+		message = html.EscapeString(capitalize(wakeErr.Error()))
+		refresh = ""
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+%s
+<title>%s</title>
+<style>body { font-family: system-ui, sans-serif; max-width: 36em; margin: 20vh auto; padding: 0 1em; text-align: center; color: #333; }</style>
+</head>
+<body>
+<h1>%s</h1>
+<p>%s</p>
+</body>
+</html>
+`, refresh, title, title, message)
+}
+
+// capitalize upper-cases the first letter of an error message for display
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
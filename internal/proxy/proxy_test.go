@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatjpcsguy/protohost/internal/registry"
+)
+
+// testBasePort is far from the ports deployments usually get, so that tests
+// don't collide with what runs on the machine
+const testBasePort = 47400
+
+// newTestServer returns a proxy using a registry in a temporary home
+// directory
+func newTestServer(t *testing.T, maxRunning int) (*Server, *registry.Registry) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	reg, err := registry.New()
+	if err != nil {
+		t.Fatalf("registry.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = reg.Close() })
+
+	return New(reg, maxRunning), reg
+}
+
+// addDeployment records a deployment with the given status in the registry
+func addDeployment(t *testing.T, reg *registry.Registry, projectName, status string) *registry.PortAllocation {
+	t.Helper()
+
+	if _, _, err := reg.AllocatePort(projectName, "main", "", 7, testBasePort, 0); err != nil {
+		t.Fatalf("AllocatePort(%s) error = %v", projectName, err)
+	}
+	if err := reg.UpdateStatus(projectName, status); err != nil {
+		t.Fatalf("UpdateStatus(%s) error = %v", projectName, err)
+	}
+	if err := reg.UpdateDeployDir(projectName, t.TempDir(), false); err != nil {
+		t.Fatalf("UpdateDeployDir(%s) error = %v", projectName, err)
+	}
+
+	alloc, err := reg.GetAllocation(projectName)
+	if err != nil {
+		t.Fatalf("GetAllocation(%s) error = %v", projectName, err)
+	}
+	return alloc
+}
+
+// fakeDocker puts a docker command on the PATH that succeeds once release
+// is called, so that wakes stay in flight until then
+func fakeDocker(t *testing.T) (release func()) {
+	t.Helper()
+
+	dir := t.TempDir()
+	hold := filepath.Join(dir, "hold")
+	if err := os.WriteFile(hold, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\nwhile [ -e %q ]; do sleep 0.01; done\n", hold)
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	release = func() { _ = os.Remove(hold) }
+	t.Cleanup(release)
+	return release
+}
+
+// waitForWakes waits until no deployment is being woken anymore
+func waitForWakes(t *testing.T, s *Server) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		waking := len(s.waking)
+		s.mu.Unlock()
+		if waking == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("deployments are still waking")
+}
+
+// request sends a request for projectName through the proxy
+func request(s *Server, projectName, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if projectName != "" {
+		r.Header.Set(ProjectHeader, projectName)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestHealth(t *testing.T) {
+	s, _ := newTestServer(t, 0)
+
+	w := request(s, "", HealthPath)
+	if w.Code != http.StatusOK {
+		t.Errorf("health status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "ok" {
+		t.Errorf("health body = %q, want %q", body, "ok")
+	}
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		project    string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "missing header",
+			path:       "/",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Missing " + ProjectHeader,
+		},
+		{
+			name:       "unknown deployment",
+			project:    "app-missing",
+			path:       "/",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "No deployment named app-missing",
+		},
+		{
+			name:       "health path for an unknown deployment",
+			project:    "app-missing",
+			path:       HealthPath,
+			wantStatus: http.StatusNotFound,
+			wantBody:   "No deployment named app-missing",
+		},
+		{
+			name:       "stopped deployment",
+			project:    "app-stopped",
+			path:       "/",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "app-stopped is stopped",
+		},
+		{
+			name:       "expired deployment",
+			project:    "app-expired",
+			path:       "/",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "app-expired is expired",
+		},
+	}
+
+	s, reg := newTestServer(t, 0)
+	addDeployment(t, reg, "app-stopped", "stopped")
+	addDeployment(t, reg, "app-expired", "expired")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := request(s, tt.project, tt.path)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServeHTTPProxiesRunning(t *testing.T) {
+	s, reg := newTestServer(t, 0)
+	alloc := addDeployment(t, reg, "app-main", "running")
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(alloc.WebPort)))
+	if err != nil {
+		t.Skipf("port %d is in use: %v", alloc.WebPort, err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s header=%q", r.Host, r.URL.Path, r.Header.Get(ProjectHeader))
+	}))
+	backend.Listener = listener
+	backend.Start()
+	defer backend.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "/page", nil)
+	r.Host = "app-main.example.com"
+	r.Header.Set(ProjectHeader, "app-main")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	body, _ := io.ReadAll(w.Body)
+	if want := `app-main.example.com /page header=""`; string(body) != want {
+		t.Errorf("backend saw %q, want %q", body, want)
+	}
+}
+
+func TestWakeQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRunning int
+		running    int // Deployments running before the request
+		waking     int // Other idle deployments requested before it
+		wantWake   bool
+	}{
+		{name: "no limit", maxRunning: 0, running: 3, waking: 1, wantWake: true},
+		{name: "below the limit", maxRunning: 2, running: 1, wantWake: true},
+		{name: "at the limit", maxRunning: 1, running: 1},
+		{name: "limit reached by waking deployments", maxRunning: 2, running: 1, waking: 1},
+		{name: "limit reached by waking deployments alone", maxRunning: 2, waking: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, reg := newTestServer(t, tt.maxRunning)
+			release := fakeDocker(t)
+			defer waitForWakes(t, s)
+			defer release()
+
+			for i := 0; i < tt.running; i++ {
+				addDeployment(t, reg, fmt.Sprintf("app-running-%d", i), "running")
+			}
+			for i := 0; i < tt.waking; i++ {
+				name := fmt.Sprintf("app-waking-%d", i)
+				addDeployment(t, reg, name, "idle")
+				request(s, name, "/")
+			}
+			addDeployment(t, reg, "app-idle", "idle")
+
+			w := request(s, "app-idle", "/")
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+			}
+
+			body := w.Body.String()
+			if tt.wantWake {
+				if !strings.Contains(body, "Starting app-idle") {
+					t.Errorf("body = %q, want the starting page", body)
+				}
+			} else {
+				if !strings.Contains(body, "Couldn't start app-idle") || !strings.Contains(body, "already running") {
+					t.Errorf("body = %q, want the limit explained", body)
+				}
+			}
+
+			s.mu.Lock()
+			waking := s.waking["app-idle"]
+			s.mu.Unlock()
+			if waking != tt.wantWake {
+				t.Errorf("waking = %v, want %v", waking, tt.wantWake)
+			}
+		})
+	}
+}
+
+func TestWakeMarksRunning(t *testing.T) {
+	s, reg := newTestServer(t, 1)
+	release := fakeDocker(t)
+	addDeployment(t, reg, "app-idle", "idle")
+
+	// Requests while it starts don't start it again
+	request(s, "app-idle", "/")
+	w := request(s, "app-idle", "/")
+	if !strings.Contains(w.Body.String(), "Starting app-idle") {
+		t.Errorf("body = %q, want the starting page", w.Body.String())
+	}
+
+	release()
+	waitForWakes(t, s)
+
+	alloc, err := reg.GetAllocation("app-idle")
+	if err != nil {
+		t.Fatalf("GetAllocation() error = %v", err)
+	}
+	if alloc.Status != "running" {
+		t.Errorf("status = %q, want %q", alloc.Status, "running")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.wakeErr["app-idle"]; err != nil {
+		t.Errorf("wake error = %v", err)
+	}
+	if s.woken["app-idle"].IsZero() {
+		t.Error("woken time wasn't recorded")
+	}
+}
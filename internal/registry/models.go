@@ -4,12 +4,19 @@ import "time"
 
 // PortAllocation represents a port allocation record
 type PortAllocation struct {
-	ID          int
-	ProjectName string
-	WebPort     int
-	Branch      string
-	CreatedAt   time.Time
-	ExpiresAt   time.Time
-	Status      string // "running", "stopped", "expired"
-	RepoURL     string
+	ID           int       `json:"id"`
+	ProjectName  string    `json:"project"`
+	WebPort      int       `json:"web_port"`
+	Branch       string    `json:"branch"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Status       string    `json:"status"` // "running", "stopped", "idle" (stopped until requested), "expired"
+	RepoURL      string    `json:"repo_url"`
+	Commit       string    `json:"commit,omitempty"`     // Exact commit SHA deployed, if known
+	Ref          string    `json:"ref,omitempty"`        // Ref deployed with --ref/--pr; empty for branch deployments
+	DeployDir    string    `json:"deploy_dir,omitempty"` // Directory the deployment runs from; empty for old records
+	ManagedDir   bool      `json:"managed_dir"`          // DeployDir was created by protohost and is removed on cleanup
+	ExpiryWarned bool      `json:"expiry_warned"`        // An expiry warning was sent for the current ExpiresAt
+	LastActiveAt time.Time `json:"last_active_at"`       // Last deploy or request through the proxy
+	SeenOnRemote bool      `json:"seen_on_remote"`       // Branch was seen in the repository, so its absence means it was deleted
 }
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -31,8 +32,11 @@ func New() (*Registry, error) {
 
 	dbPath := filepath.Join(protohostDir, "registry.db")
 
-	// Open database
-	db, err := sql.Open("sqlite3", dbPath)
+	// Open database. The proxy, daemon and deploys use it at the same time,
+	// so writers wait for each other rather than failing, and readers don't
+	// block writers. Transactions take the write lock when they begin, so
+	// that what they read can't change before they write.
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -48,6 +52,12 @@ func New() (*Registry, error) {
 	return r, nil
 }
 
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 // Close closes the database connection
 func (r *Registry) Close() error {
 	return r.db.Close()
@@ -76,25 +86,125 @@ func (r *Registry) initSchema() error {
 		return fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	// Columns added after the initial schema
+	if err := r.addColumnIfMissing("commit_sha", "TEXT"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfMissing("ref", "TEXT"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfMissing("deploy_dir", "TEXT"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfMissing("managed_dir", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfMissing("expiry_warned", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfMissing("last_active_at", "TEXT"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfMissing("seen_on_remote", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// addColumnIfMissing adds a column to port_allocations for registries
+// created by older versions
+func (r *Registry) addColumnIfMissing(column, definition string) error {
+	rows, err := r.db.Query("PRAGMA table_info(port_allocations)")
+	if err != nil {
+		return fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect schema: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect schema: %w", err)
+	}
+
+	if _, err := r.db.Exec(fmt.Sprintf("ALTER TABLE port_allocations ADD COLUMN %s %s", column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s column: %w", column, err)
+	}
+
+	return nil
+}
+
+// ErrTooManyRunning is returned by AllocatePort when the host already runs
+// the maximum number of deployments
+var ErrTooManyRunning = errors.New("too many running deployments")
+
 // AllocatePort allocates a port for a project, or returns existing allocation
 // Returns (port, isNew, error) where isNew indicates if this is a new deployment
-func (r *Registry) AllocatePort(projectName, branch, repoURL string, ttlDays, basePort int) (int, bool, error) {
+// If maxRunning is positive, it fails with ErrTooManyRunning if that many
+// other deployments are already running. The quota is checked and the port
+// allocated in one transaction, so concurrent deploys can't both pass it.
+func (r *Registry) AllocatePort(projectName, branch, repoURL string, ttlDays, basePort, maxRunning int) (int, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	port, isNew, err := r.allocatePort(tx, projectName, branch, repoURL, ttlDays, basePort, maxRunning)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to commit allocation: %w", err)
+	}
+
+	return port, isNew, nil
+}
+
+// allocatePort does the work of AllocatePort within tx
+func (r *Registry) allocatePort(tx *sql.Tx, projectName, branch, repoURL string, ttlDays, basePort, maxRunning int) (int, bool, error) {
+	if maxRunning > 0 {
+		running, err := countRunning(tx, projectName)
+		if err != nil {
+			return 0, false, err
+		}
+		if running >= maxRunning {
+			return 0, false, fmt.Errorf("%w: %d of %d allowed are running, stop one with 'protohost down' first",
+				ErrTooManyRunning, running, maxRunning)
+		}
+	}
+
 	// Check if project already has a port
 	var existingPort int
-	err := r.db.QueryRow(
+	err := tx.QueryRow(
 		"SELECT web_port FROM port_allocations WHERE project_name = ?",
 		projectName,
 	).Scan(&existingPort)
 
 	if err == nil {
-		// Port already allocated, update expiration and status
-		expiresAt := time.Now().UTC().AddDate(0, 0, ttlDays).Format(time.RFC3339)
-		_, err = r.db.Exec(
-			"UPDATE port_allocations SET expires_at = ?, status = 'running' WHERE project_name = ?",
-			expiresAt, projectName,
+		// Port already allocated, update expiration and status. The new
+		// expiry hasn't been warned about yet, and the deploy records
+		// whether the branch is on the remote again.
+		now := time.Now().UTC()
+		expiresAt := now.AddDate(0, 0, ttlDays).Format(time.RFC3339)
+		_, err = tx.Exec(
+			"UPDATE port_allocations SET expires_at = ?, status = 'running', expiry_warned = 0, seen_on_remote = 0, last_active_at = ? WHERE project_name = ?",
+			expiresAt, now.Format(time.RFC3339), projectName,
 		)
 		if err != nil {
 			return 0, false, fmt.Errorf("failed to update expiration: %w", err)
@@ -107,7 +217,7 @@ func (r *Registry) AllocatePort(projectName, branch, repoURL string, ttlDays, ba
 	}
 
 	// Find next available port
-	port, err := r.findAvailablePort(basePort)
+	port, err := r.findAvailablePort(tx, basePort)
 	if err != nil {
 		return 0, false, err
 	}
@@ -116,10 +226,10 @@ func (r *Registry) AllocatePort(projectName, branch, repoURL string, ttlDays, ba
 	createdAt := time.Now().UTC().Format(time.RFC3339)
 	expiresAt := time.Now().UTC().AddDate(0, 0, ttlDays).Format(time.RFC3339)
 
-	_, err = r.db.Exec(`
-		INSERT INTO port_allocations (project_name, web_port, branch, created_at, expires_at, status, repo_url)
-		VALUES (?, ?, ?, ?, ?, 'running', ?)
-	`, projectName, port, branch, createdAt, expiresAt, repoURL)
+	_, err = tx.Exec(`
+		INSERT INTO port_allocations (project_name, web_port, branch, created_at, expires_at, status, repo_url, last_active_at)
+		VALUES (?, ?, ?, ?, ?, 'running', ?, ?)
+	`, projectName, port, branch, createdAt, expiresAt, repoURL, createdAt)
 
 	if err != nil {
 		return 0, false, fmt.Errorf("failed to insert allocation: %w", err)
@@ -129,9 +239,9 @@ func (r *Registry) AllocatePort(projectName, branch, repoURL string, ttlDays, ba
 }
 
 // findAvailablePort finds the first available port starting from basePort
-func (r *Registry) findAvailablePort(basePort int) (int, error) {
+func (r *Registry) findAvailablePort(q queryer, basePort int) (int, error) {
 	// Get all allocated ports from registry
-	rows, err := r.db.Query("SELECT web_port FROM port_allocations")
+	rows, err := q.Query("SELECT web_port FROM port_allocations")
 	if err != nil {
 		return 0, fmt.Errorf("failed to query ports: %w", err)
 	}
@@ -194,10 +304,29 @@ func (r *Registry) UpdateStatus(projectName, status string) error {
 	return nil
 }
 
+// CountRunning returns the number of running deployments, not counting
+// the excluded project
+func (r *Registry) CountRunning(exclude string) (int, error) {
+	return countRunning(r.db, exclude)
+}
+
+// countRunning does the work of CountRunning with q
+func countRunning(q queryer, exclude string) (int, error) {
+	var count int
+	err := q.QueryRow(
+		"SELECT COUNT(*) FROM port_allocations WHERE status = 'running' AND project_name != ?",
+		exclude,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count running deployments: %w", err)
+	}
+	return count, nil
+}
+
 // ListAllocations returns all port allocations
 func (r *Registry) ListAllocations() ([]PortAllocation, error) {
 	rows, err := r.db.Query(`
-		SELECT id, project_name, web_port, branch, created_at, expires_at, status, COALESCE(repo_url, '')
+		SELECT ` + allocationColumns + `
 		FROM port_allocations
 		ORDER BY created_at DESC
 	`)
@@ -208,36 +337,27 @@ func (r *Registry) ListAllocations() ([]PortAllocation, error) {
 
 	var allocations []PortAllocation
 	for rows.Next() {
-		var a PortAllocation
-		var createdAt, expiresAt string
-
-		err := rows.Scan(
-			&a.ID, &a.ProjectName, &a.WebPort, &a.Branch,
-			&createdAt, &expiresAt, &a.Status, &a.RepoURL,
-		)
+		a, err := scanAllocation(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		// Parse timestamps
-		a.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		a.ExpiresAt, _ = time.Parse(time.RFC3339, expiresAt)
-
-		allocations = append(allocations, a)
+		allocations = append(allocations, *a)
 	}
 
 	return allocations, nil
 }
 
-// MarkExpired marks deployments as expired if they're past their TTL
+// MarkExpired marks deployments as expired if they're past their TTL and
+// returns every expired deployment still in the registry, including ones a
+// previous cleanup marked but didn't remove
 func (r *Registry) MarkExpired() ([]PortAllocation, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 
 	// Get expired deployments
 	rows, err := r.db.Query(`
-		SELECT id, project_name, web_port, branch, created_at, expires_at, status, COALESCE(repo_url, '')
+		SELECT `+allocationColumns+`
 		FROM port_allocations
-		WHERE expires_at < ? AND status != 'expired'
+		WHERE expires_at < ?
 	`, now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query expired: %w", err)
@@ -246,21 +366,11 @@ func (r *Registry) MarkExpired() ([]PortAllocation, error) {
 
 	var expired []PortAllocation
 	for rows.Next() {
-		var a PortAllocation
-		var createdAt, expiresAt string
-
-		err := rows.Scan(
-			&a.ID, &a.ProjectName, &a.WebPort, &a.Branch,
-			&createdAt, &expiresAt, &a.Status, &a.RepoURL,
-		)
+		a, err := scanAllocation(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		a.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		a.ExpiresAt, _ = time.Parse(time.RFC3339, expiresAt)
-
-		expired = append(expired, a)
+		expired = append(expired, *a)
 	}
 
 	// Mark as expired
@@ -274,20 +384,68 @@ func (r *Registry) MarkExpired() ([]PortAllocation, error) {
 	return expired, nil
 }
 
+// ExpiringWithin returns live deployments that expire within d and haven't
+// had an expiry warning sent yet
+func (r *Registry) ExpiringWithin(d time.Duration) ([]PortAllocation, error) {
+	now := time.Now().UTC()
+
+	rows, err := r.db.Query(`
+		SELECT `+allocationColumns+`
+		FROM port_allocations
+		WHERE expires_at >= ? AND expires_at < ? AND status != 'expired' AND expiry_warned = 0
+		ORDER BY expires_at
+	`, now.Format(time.RFC3339), now.Add(d).Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expiring: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var expiring []PortAllocation
+	for rows.Next() {
+		a, err := scanAllocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		expiring = append(expiring, *a)
+	}
+
+	return expiring, nil
+}
+
+// MarkExpiryWarned records that an expiry warning was sent for a deployment
+func (r *Registry) MarkExpiryWarned(projectName string) error {
+	_, err := r.db.Exec(
+		"UPDATE port_allocations SET expiry_warned = 1 WHERE project_name = ?",
+		projectName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark expiry warned: %w", err)
+	}
+	return nil
+}
+
+// MarkSeenOnRemote records that a deployment's branch exists in its
+// repository, so that it can be treated as deleted once it's gone
+func (r *Registry) MarkSeenOnRemote(projectName string) error {
+	_, err := r.db.Exec(
+		"UPDATE port_allocations SET seen_on_remote = 1 WHERE project_name = ?",
+		projectName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark branch seen on remote: %w", err)
+	}
+	return nil
+}
+
 // GetAllocation returns the allocation for a project
 func (r *Registry) GetAllocation(projectName string) (*PortAllocation, error) {
-	var a PortAllocation
-	var createdAt, expiresAt string
-
-	err := r.db.QueryRow(`
-		SELECT id, project_name, web_port, branch, created_at, expires_at, status, COALESCE(repo_url, '')
+	row := r.db.QueryRow(`
+		SELECT `+allocationColumns+`
 		FROM port_allocations
 		WHERE project_name = ?
-	`, projectName).Scan(
-		&a.ID, &a.ProjectName, &a.WebPort, &a.Branch,
-		&createdAt, &expiresAt, &a.Status, &a.RepoURL,
-	)
+	`, projectName)
 
+	a, err := scanAllocation(row)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("no allocation found for %s", projectName)
 	}
@@ -295,8 +453,72 @@ func (r *Registry) GetAllocation(projectName string) (*PortAllocation, error) {
 		return nil, fmt.Errorf("failed to get allocation: %w", err)
 	}
 
+	return a, nil
+}
+
+// UpdateRevision records the ref (empty for branch deployments) and commit
+// a deployment is running
+func (r *Registry) UpdateRevision(projectName, ref, commit string) error {
+	_, err := r.db.Exec(
+		"UPDATE port_allocations SET ref = ?, commit_sha = ? WHERE project_name = ?",
+		ref, commit, projectName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update commit: %w", err)
+	}
+	return nil
+}
+
+// TouchActivity records that a deployment was just used
+func (r *Registry) TouchActivity(projectName string) error {
+	_, err := r.db.Exec(
+		"UPDATE port_allocations SET last_active_at = ? WHERE project_name = ?",
+		time.Now().UTC().Format(time.RFC3339), projectName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record activity: %w", err)
+	}
+	return nil
+}
+
+// UpdateDeployDir records the directory a deployment runs from. managed
+// indicates protohost created the directory and may delete it on cleanup.
+func (r *Registry) UpdateDeployDir(projectName, deployDir string, managed bool) error {
+	_, err := r.db.Exec(
+		"UPDATE port_allocations SET deploy_dir = ?, managed_dir = ? WHERE project_name = ?",
+		deployDir, managed, projectName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update deploy directory: %w", err)
+	}
+	return nil
+}
+
+// allocationColumns lists the columns read by scanAllocation, in order
+const allocationColumns = `id, project_name, web_port, branch, created_at, expires_at, status,
+		COALESCE(repo_url, ''), COALESCE(commit_sha, ''), COALESCE(ref, ''),
+		COALESCE(deploy_dir, ''), managed_dir, expiry_warned, COALESCE(last_active_at, created_at),
+		seen_on_remote`
+
+// scanAllocation reads a row selected with allocationColumns
+func scanAllocation(row interface{ Scan(...any) error }) (*PortAllocation, error) {
+	var a PortAllocation
+	var createdAt, expiresAt, lastActiveAt string
+
+	err := row.Scan(
+		&a.ID, &a.ProjectName, &a.WebPort, &a.Branch,
+		&createdAt, &expiresAt, &a.Status, &a.RepoURL, &a.Commit, &a.Ref,
+		&a.DeployDir, &a.ManagedDir, &a.ExpiryWarned, &lastActiveAt,
+		&a.SeenOnRemote,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse timestamps
 	a.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
 	a.ExpiresAt, _ = time.Parse(time.RFC3339, expiresAt)
+	a.LastActiveAt, _ = time.Parse(time.RFC3339, lastActiveAt)
 
 	return &a, nil
 }
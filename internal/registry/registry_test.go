@@ -0,0 +1,253 @@
+package registry
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBasePort is far from the ports deployments usually get, so that tests
+// don't collide with what runs on the machine
+const testBasePort = 47300
+
+// newTestRegistry opens a registry in a temporary home directory
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	reg, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = reg.Close() })
+	return reg
+}
+
+func TestAllocatePort(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	first, isNew, err := reg.AllocatePort("app-main", "main", "", 7, testBasePort, 0)
+	if err != nil {
+		t.Fatalf("AllocatePort() error = %v", err)
+	}
+	if !isNew {
+		t.Error("AllocatePort() isNew = false for a new project")
+	}
+	if first < testBasePort || first >= testBasePort+100 {
+		t.Errorf("AllocatePort() = %d, want a port in %d-%d", first, testBasePort, testBasePort+99)
+	}
+
+	second, isNew, err := reg.AllocatePort("app-feature", "feature", "", 7, testBasePort, 0)
+	if err != nil {
+		t.Fatalf("AllocatePort() error = %v", err)
+	}
+	if !isNew {
+		t.Error("AllocatePort() isNew = false for a second project")
+	}
+	if second <= first {
+		t.Errorf("AllocatePort() = %d for the second project, want a port after %d", second, first)
+	}
+
+	again, isNew, err := reg.AllocatePort("app-main", "main", "", 7, testBasePort, 0)
+	if err != nil {
+		t.Fatalf("AllocatePort() error = %v", err)
+	}
+	if isNew {
+		t.Error("AllocatePort() isNew = true for an existing project")
+	}
+	if again != first {
+		t.Errorf("AllocatePort() = %d for an existing project, want %d", again, first)
+	}
+}
+
+func TestAllocatePortSkipsPortsInUse(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", testBasePort+50))
+	if err != nil {
+		t.Skipf("port %d is in use: %v", testBasePort+50, err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	port, _, err := reg.AllocatePort("app-main", "main", "", 7, testBasePort+50, 0)
+	if err != nil {
+		t.Fatalf("AllocatePort() error = %v", err)
+	}
+	if port == testBasePort+50 {
+		t.Errorf("AllocatePort() = %d, which is in use", port)
+	}
+}
+
+func TestAllocatePortMaxRunning(t *testing.T) {
+	tests := []struct {
+		name       string
+		running    []string // Projects running before the allocation
+		stopped    []string // Projects stopped before the allocation
+		project    string
+		maxRunning int
+		wantErr    bool
+	}{
+		{
+			name:       "no limit",
+			running:    []string{"app-a", "app-b"},
+			project:    "app-c",
+			maxRunning: 0,
+		},
+		{
+			name:       "below the limit",
+			running:    []string{"app-a"},
+			project:    "app-c",
+			maxRunning: 2,
+		},
+		{
+			name:       "at the limit",
+			running:    []string{"app-a", "app-b"},
+			project:    "app-c",
+			maxRunning: 2,
+			wantErr:    true,
+		},
+		{
+			name:       "redeploy of a running project at the limit",
+			running:    []string{"app-a", "app-b"},
+			project:    "app-a",
+			maxRunning: 2,
+		},
+		{
+			name:       "stopped projects don't count",
+			running:    []string{"app-a"},
+			stopped:    []string{"app-b", "app-c"},
+			project:    "app-d",
+			maxRunning: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newTestRegistry(t)
+			for _, name := range append(tt.running, tt.stopped...) {
+				if _, _, err := reg.AllocatePort(name, "main", "", 7, testBasePort, 0); err != nil {
+					t.Fatalf("AllocatePort(%s) error = %v", name, err)
+				}
+			}
+			for _, name := range tt.stopped {
+				if err := reg.UpdateStatus(name, "stopped"); err != nil {
+					t.Fatalf("UpdateStatus(%s) error = %v", name, err)
+				}
+			}
+
+			_, _, err := reg.AllocatePort(tt.project, "main", "", 7, testBasePort, tt.maxRunning)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTooManyRunning) {
+					t.Fatalf("AllocatePort() error = %v, want ErrTooManyRunning", err)
+				}
+				if alloc, _ := reg.GetAllocation(tt.project); alloc != nil {
+					t.Errorf("AllocatePort() allocated %s despite the limit", tt.project)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AllocatePort() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCountRunning(t *testing.T) {
+	reg := newTestRegistry(t)
+	for _, name := range []string{"app-a", "app-b", "app-c"} {
+		if _, _, err := reg.AllocatePort(name, "main", "", 7, testBasePort, 0); err != nil {
+			t.Fatalf("AllocatePort(%s) error = %v", name, err)
+		}
+	}
+	if err := reg.UpdateStatus("app-c", "idle"); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+
+	tests := []struct {
+		exclude string
+		want    int
+	}{
+		{exclude: "", want: 2},
+		{exclude: "app-a", want: 1},
+		{exclude: "app-c", want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run("exclude "+tt.exclude, func(t *testing.T) {
+			got, err := reg.CountRunning(tt.exclude)
+			if err != nil {
+				t.Fatalf("CountRunning() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CountRunning(%q) = %d, want %d", tt.exclude, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigratesOldRegistry(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// A registry as created by the first versions of protohost
+	dir := filepath.Join(home, ".protohost")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "registry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE port_allocations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_name TEXT NOT NULL UNIQUE,
+		web_port INTEGER NOT NULL UNIQUE,
+		branch TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		status TEXT NOT NULL,
+		repo_url TEXT
+	);
+	INSERT INTO port_allocations (project_name, web_port, branch, created_at, expires_at, status, repo_url)
+	VALUES ('app-main', 3000, 'main', '2026-01-01T00:00:00Z', '2026-01-08T00:00:00Z', 'running', '');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	reg, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	alloc, err := reg.GetAllocation("app-main")
+	if err != nil {
+		t.Fatalf("GetAllocation() error = %v", err)
+	}
+	if alloc == nil || alloc.WebPort != 3000 || alloc.DeployDir != "" || alloc.ManagedDir {
+		t.Errorf("GetAllocation() = %+v, want the old record with empty new columns", alloc)
+	}
+	if err := reg.UpdateDeployDir("app-main", "/srv/app", true); err != nil {
+		t.Errorf("UpdateDeployDir() error = %v", err)
+	}
+	_ = reg.Close()
+
+	// Opening it again leaves the migrated registry as it is
+	reg, err = New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = reg.Close() }()
+	alloc, err = reg.GetAllocation("app-main")
+	if err != nil {
+		t.Fatalf("GetAllocation() error = %v", err)
+	}
+	if alloc == nil || alloc.DeployDir != "/srv/app" || !alloc.ManagedDir {
+		t.Errorf("GetAllocation() = %+v, want the deploy directory kept", alloc)
+	}
+}
@@ -3,28 +3,169 @@ package ssh
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/pkg/sftp"
+	"github.com/thatjpcsguy/protohost/internal/config"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
 	"golang.org/x/term"
 )
 
+// keepaliveInterval is how often an idle connection is pinged
+const keepaliveInterval = 30 * time.Second
+
+var (
+	signersMu sync.Mutex
+	signers   = make(map[string]ssh.Signer)
+)
+
 // Client represents an SSH client
 type Client struct {
-	Host       string
-	User       string
-	client     *ssh.Client
-	jumpClient *ssh.Client // Optional jump host client
+	Host        string
+	User        string
+	client      *ssh.Client
+	jumpClients []*ssh.Client // Optional jump host chain, in dial order
+
+	sftpMu     sync.Mutex
+	sftpClient *sftp.Client // Opened lazily for file transfers
+
+	done      chan struct{}
+	closeOnce sync.Once
+	dead      atomic.Bool
+}
+
+// NewClient creates a new SSH client, dialing through each jump host in turn
+func NewClient(user, host, configKeyPath string, jumpHosts []config.JumpHost) (*Client, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	signer, err := loadSigner(configKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load known_hosts
+	knownHostsPath := filepath.Join(home, ".ssh", "known_hosts")
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		// If known_hosts doesn't exist, use insecure (not recommended for production)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+
+	config := &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	// Connect to each jump host through the previous one
+	var jumpClients []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumpClients) - 1; i >= 0; i-- {
+			_ = jumpClients[i].Close()
+		}
+	}
+
+	for _, hop := range jumpHosts {
+		hopSigner, err := loadSigner(hop.KeyPath)
+		if err != nil {
+			closeJumps()
+			return nil, err
+		}
+
+		jumpConfig := &ssh.ClientConfig{
+			User: hop.User,
+			Auth: []ssh.AuthMethod{
+				ssh.PublicKeys(hopSigner),
+			},
+			HostKeyCallback: hostKeyCallback,
+		}
+
+		jumpClient, err := dialVia(jumpClients, hostPort(hop.Host, hop.Port), jumpConfig)
+		if err != nil {
+			closeJumps()
+			return nil, fmt.Errorf("failed to connect to jump host %s: %w", hop, err)
+		}
+		jumpClients = append(jumpClients, jumpClient)
+	}
+
+	// Connect to target host through the last jump host (or directly)
+	client, err := dialVia(jumpClients, hostPort(host, 22), config)
+	if err != nil {
+		closeJumps()
+		if len(jumpClients) > 0 {
+			return nil, fmt.Errorf("failed to connect to %s@%s through jump host: %w", user, host, err)
+		}
+		return nil, fmt.Errorf("failed to connect to %s@%s: %w", user, host, err)
+	}
+
+	c := &Client{
+		Host:        host,
+		User:        user,
+		client:      client,
+		jumpClients: jumpClients,
+		done:        make(chan struct{}),
+	}
+	go c.keepalive()
+
+	return c, nil
+}
+
+// dialVia opens an SSH connection to addr, tunnelled through the last of the
+// given jump clients, or directly if there are none
+func dialVia(jumpClients []*ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(jumpClients) == 0 {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := jumpClients[len(jumpClients)-1].Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
+	}
+
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// hostPort joins a host and port, defaulting to port 22
+func hostPort(host string, port int) string {
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
 
-// NewClient creates a new SSH client
-func NewClient(user, host, configKeyPath string, jumpUser, jumpHost string) (*Client, error) {
-	// Get SSH key path
+// loadSigner reads and parses the SSH private key, prompting for a passphrase
+// if needed. Signers are cached per key path so the passphrase is only asked
+// once per invocation, regardless of how many hosts we connect to.
+func loadSigner(configKeyPath string) (ssh.Signer, error) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+
+	if signer, ok := signers[configKeyPath]; ok {
+		return signer, nil
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
@@ -58,8 +199,14 @@ func NewClient(user, host, configKeyPath string, jumpUser, jumpHost string) (*Cl
 	if err != nil {
 		// Check if the error is due to passphrase protection
 		if strings.Contains(err.Error(), "passphrase") ||
-		   strings.Contains(err.Error(), "encrypted") ||
-		   strings.Contains(err.Error(), "cannot decode") {
+			strings.Contains(err.Error(), "encrypted") ||
+			strings.Contains(err.Error(), "cannot decode") {
+			// Services like the daemon have no terminal to prompt on, and
+			// reading one would fail or hang
+			if !term.IsTerminal(int(syscall.Stdin)) {
+				return nil, fmt.Errorf("SSH key %s is protected by a passphrase and there's no terminal to ask for it; use a key without a passphrase for unattended runs", keyPath)
+			}
+
 			// Prompt for passphrase
 			fmt.Printf("Enter passphrase for %s: ", keyPath)
 			passphrase, passphraseErr := term.ReadPassword(int(syscall.Stdin))
@@ -78,81 +225,53 @@ func NewClient(user, host, configKeyPath string, jumpUser, jumpHost string) (*Cl
 		}
 	}
 
-	// Load known_hosts
-	knownHostsPath := filepath.Join(home, ".ssh", "known_hosts")
-	hostKeyCallback, err := knownhosts.New(knownHostsPath)
-	if err != nil {
-		// If known_hosts doesn't exist, use insecure (not recommended for production)
-		hostKeyCallback = ssh.InsecureIgnoreHostKey()
-	}
-
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: hostKeyCallback,
-	}
-
-	var client *ssh.Client
-	var jumpClient *ssh.Client
-
-	// If jump host is specified, connect through it
-	if jumpHost != "" {
-		// Connect to jump host first
-		jumpConfig := &ssh.ClientConfig{
-			User: jumpUser,
-			Auth: []ssh.AuthMethod{
-				ssh.PublicKeys(signer),
-			},
-			HostKeyCallback: hostKeyCallback,
-		}
-
-		jumpClient, err = ssh.Dial("tcp", fmt.Sprintf("%s:22", jumpHost), jumpConfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to jump host %s@%s: %w", jumpUser, jumpHost, err)
-		}
-
-		// Connect to target host through jump host
-		conn, err := jumpClient.Dial("tcp", fmt.Sprintf("%s:22", host))
-		if err != nil {
-			_ = jumpClient.Close()
-			return nil, fmt.Errorf("failed to dial %s through jump host: %w", host, err)
-		}
-
-		// Create SSH connection over the jump host connection
-		ncc, chans, reqs, err := ssh.NewClientConn(conn, fmt.Sprintf("%s:22", host), config)
-		if err != nil {
-			_ = conn.Close()
-			_ = jumpClient.Close()
-			return nil, fmt.Errorf("failed to create SSH connection through jump host: %w", err)
-		}
+	signers[configKeyPath] = signer
+	return signer, nil
+}
 
-		client = ssh.NewClient(ncc, chans, reqs)
-	} else {
-		// Direct connection (no jump host)
-		client, err = ssh.Dial("tcp", fmt.Sprintf("%s:22", host), config)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to %s@%s: %w", user, host, err)
+// keepalive periodically pings the server so idle pooled connections aren't
+// dropped by NAT or sshd timeouts. A failed ping marks the client as dead.
+func (c *Client) keepalive() {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if _, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				c.dead.Store(true)
+				return
+			}
 		}
 	}
+}
 
-	return &Client{
-		Host:       host,
-		User:       user,
-		client:     client,
-		jumpClient: jumpClient,
-	}, nil
+// Alive reports whether the connection is still usable
+func (c *Client) Alive() bool {
+	return !c.dead.Load()
 }
 
 // Close closes the SSH connection
 func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	c.dead.Store(true)
+
+	c.sftpMu.Lock()
+	if c.sftpClient != nil {
+		_ = c.sftpClient.Close()
+		c.sftpClient = nil
+	}
+	c.sftpMu.Unlock()
+
 	var err error
 	if c.client != nil {
 		err = c.client.Close()
 	}
-	if c.jumpClient != nil {
-		if jumpErr := c.jumpClient.Close(); jumpErr != nil && err == nil {
+	// Close jump hosts in reverse order, innermost first
+	for i := len(c.jumpClients) - 1; i >= 0; i-- {
+		if jumpErr := c.jumpClients[i].Close(); jumpErr != nil && err == nil {
 			err = jumpErr
 		}
 	}
@@ -195,34 +314,39 @@ func (c *Client) ExecuteInteractive(command string) error {
 	return nil
 }
 
-// SCP copies a file to the remote host
-func (c *Client) SCP(localPath, remotePath string) error {
-	// Read local file
-	content, err := os.ReadFile(localPath)
-	if err != nil {
-		return fmt.Errorf("failed to read local file: %w", err)
-	}
-
-	// Create remote file
+// ExecuteWithStdin runs a command with stdin streamed from r, streaming
+// output to the terminal
+func (c *Client) ExecuteWithStdin(command string, r io.Reader) error {
 	session, err := c.client.NewSession()
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
 	}
 	defer func() { _ = session.Close() }()
 
-	// Use cat to write file
-	stdin, err := session.StdinPipe()
+	session.Stdin = r
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	if err := session.Run(command); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteStream runs a command, streaming its output to stdout and stderr
+func (c *Client) ExecuteStream(command string, stdout, stderr io.Writer) error {
+	session, err := c.client.NewSession()
 	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe: %w", err)
+		return fmt.Errorf("failed to create session: %w", err)
 	}
+	defer func() { _ = session.Close() }()
 
-	go func() {
-		defer func() { _ = stdin.Close() }()
-		_, _ = stdin.Write(content)
-	}()
+	session.Stdout = stdout
+	session.Stderr = stderr
 
-	if err := session.Run(fmt.Sprintf("cat > %s", remotePath)); err != nil {
-		return fmt.Errorf("failed to write remote file: %w", err)
+	if err := session.Run(command); err != nil {
+		return fmt.Errorf("command failed: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Forward accepts connections on listener and forwards each one to addr, as
+// seen from the remote server, until listener is closed
+func (c *Client) Forward(listener net.Listener, addr string) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		go c.forwardConn(conn, addr)
+	}
+}
+
+// forwardConn copies data between a local connection and addr until either
+// side closes
+func (c *Client) forwardConn(local net.Conn, addr string) {
+	defer func() { _ = local.Close() }()
+
+	remote, err := c.client.Dial("tcp", addr)
+	if err != nil {
+		fmt.Printf("Warning: failed to connect to %s: %v\n", addr, err)
+		return
+	}
+	defer func() { _ = remote.Close() }()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
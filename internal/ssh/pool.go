@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thatjpcsguy/protohost/internal/config"
+)
+
+// pool holds connections shared for the lifetime of a single protohost
+// invocation (or a daemon pass), keyed by user@host, the key used and the
+// jump hosts used to reach it
+var pool = struct {
+	sync.Mutex
+	clients map[string]*Client
+}{clients: make(map[string]*Client)}
+
+// Connect returns a pooled SSH client for the given target, dialing a new
+// connection only if none is cached or the cached one has died.
+// Pooled clients must not be closed by callers; use CloseAll when done.
+func Connect(user, host, configKeyPath string, jumpHosts []config.JumpHost) (*Client, error) {
+	key := poolKey(user, host, configKeyPath, jumpHosts)
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if c, ok := pool.clients[key]; ok {
+		if c.Alive() {
+			return c, nil
+		}
+		_ = c.Close()
+		delete(pool.clients, key)
+	}
+
+	c, err := NewClient(user, host, configKeyPath, jumpHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	pool.clients[key] = c
+	return c, nil
+}
+
+// CloseAll closes every pooled connection
+func CloseAll() {
+	pool.Lock()
+	defer pool.Unlock()
+
+	for key, c := range pool.clients {
+		_ = c.Close()
+		delete(pool.clients, key)
+	}
+}
+
+// poolKey builds the cache key for a connection target. Targets reached
+// with different keys get separate connections, as they may log in as
+// different identities.
+func poolKey(user, host, keyPath string, jumpHosts []config.JumpHost) string {
+	key := fmt.Sprintf("%s@%s?key=%s", user, host, keyPath)
+	for _, hop := range jumpHosts {
+		key += fmt.Sprintf("+%s?key=%s", hop, hop.KeyPath)
+	}
+	return key
+}
@@ -0,0 +1,366 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// progressThreshold is the file size above which transfers report progress
+const progressThreshold = 1 << 20
+
+// sftpSession returns the client's SFTP session, opening it on first use
+func (c *Client) sftpSession() (*sftp.Client, error) {
+	c.sftpMu.Lock()
+	defer c.sftpMu.Unlock()
+
+	if c.sftpClient != nil {
+		return c.sftpClient, nil
+	}
+
+	client, err := sftp.NewClient(c.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+
+	c.sftpClient = client
+	return client, nil
+}
+
+// Upload copies a local file to the remote host, preserving its mode.
+// The file is written to a temporary name and renamed into place, so the
+// remote path never holds a partial upload.
+func (c *Client) Upload(localPath, remotePath string) error {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+
+	return c.upload(src, info.Size(), info.Mode().Perm(), remotePath)
+}
+
+// UploadBytes writes content to a file on the remote host with the given mode
+func (c *Client) UploadBytes(content []byte, remotePath string, mode os.FileMode) error {
+	return c.upload(bytes.NewReader(content), int64(len(content)), mode, remotePath)
+}
+
+// upload streams r into remotePath via a temporary file and atomic rename
+func (c *Client) upload(r io.Reader, size int64, mode os.FileMode, remotePath string) error {
+	client, err := c.sftpSession()
+	if err != nil {
+		return err
+	}
+
+	remotePath = sftpPath(remotePath)
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	tmpPath := remotePath + ".protohost-tmp"
+	dst, err := client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+
+	if size > progressThreshold {
+		r = newProgressReader(r, size, path.Base(remotePath))
+	}
+
+	written, err := io.Copy(dst, r)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("short write: %d of %d bytes", written, size)
+	}
+	if err != nil {
+		_ = client.Remove(tmpPath)
+		return fmt.Errorf("failed to write remote file: %w", err)
+	}
+
+	if err := client.Chmod(tmpPath, mode); err != nil {
+		_ = client.Remove(tmpPath)
+		return fmt.Errorf("failed to set remote file mode: %w", err)
+	}
+
+	if err := client.PosixRename(tmpPath, remotePath); err != nil {
+		_ = client.Remove(tmpPath)
+		return fmt.Errorf("failed to move remote file into place: %w", err)
+	}
+
+	return nil
+}
+
+// Download copies a remote file to the local machine, preserving its mode
+func (c *Client) Download(remotePath, localPath string) error {
+	client, err := c.sftpSession()
+	if err != nil {
+		return err
+	}
+
+	src, err := client.Open(sftpPath(remotePath))
+	if err != nil {
+		return fmt.Errorf("failed to open remote file: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat remote file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create local directory: %w", err)
+	}
+
+	tmpPath := localPath + ".protohost-tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+
+	var r io.Reader = src
+	if info.Size() > progressThreshold {
+		r = newProgressReader(src, info.Size(), filepath.Base(localPath))
+	}
+
+	_, err = io.Copy(dst, r)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// Not affected by the umask, unlike the mode the file was created with
+		err = os.Chmod(tmpPath, info.Mode().Perm())
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return os.Rename(tmpPath, localPath)
+}
+
+// SyncResult describes what SyncDir did
+type SyncResult struct {
+	// Files maps each file and symlink synced, relative to the local
+	// directory and slash-separated, to its local mode
+	Files     map[string]os.FileMode
+	Uploaded  int // Files sent because the remote copy was missing or differed
+	Updated   int // Files and symlinks fixed without sending content (mode or link target)
+	Unchanged int
+}
+
+// SyncDir uploads a local directory tree to the remote host. Like rsync,
+// each file is compared with the remote copy and only sent if it's missing
+// or its size or modification time differ; a file whose mode alone differs
+// is just chmodded. Symlinks are recreated as symlinks, and other special
+// files are skipped with a warning. If skip is non-nil, paths (relative to
+// localDir, slash-separated) for which it returns true aren't synced.
+func (c *Client) SyncDir(localDir, remoteDir string, skip func(rel string, isDir bool) bool) (SyncResult, error) {
+	result := SyncResult{Files: make(map[string]os.FileMode)}
+
+	client, err := c.sftpSession()
+	if err != nil {
+		return result, err
+	}
+	remoteDir = sftpPath(remoteDir)
+
+	// Remote directories are listed once, rather than stat'ing every file
+	listings := make(map[string]map[string]os.FileInfo)
+
+	err = filepath.WalkDir(localDir, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "." && skip != nil && skip(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		remotePath := path.Join(remoteDir, rel)
+
+		if entry.IsDir() {
+			listings[remotePath], err = c.listRemoteDir(remotePath)
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		remote := listings[path.Dir(remotePath)][entry.Name()]
+
+		switch {
+		case info.Mode().IsRegular():
+			result.Files[rel] = info.Mode().Perm()
+			switch {
+			case remote == nil || !remote.Mode().IsRegular() || remote.Size() != info.Size() || remote.ModTime().Unix() != info.ModTime().Unix():
+				if remote != nil && remote.IsDir() {
+					if err := client.RemoveAll(remotePath); err != nil {
+						return fmt.Errorf("failed to replace remote directory %s: %w", rel, err)
+					}
+				}
+				if err := c.Upload(localPath, remotePath); err != nil {
+					return fmt.Errorf("failed to upload %s: %w", rel, err)
+				}
+				if err := client.Chtimes(remotePath, info.ModTime(), info.ModTime()); err != nil {
+					return fmt.Errorf("failed to set modification time on %s: %w", rel, err)
+				}
+				result.Uploaded++
+			case remote.Mode().Perm() != info.Mode().Perm():
+				if err := client.Chmod(remotePath, info.Mode().Perm()); err != nil {
+					return fmt.Errorf("failed to set mode on %s: %w", rel, err)
+				}
+				result.Updated++
+			default:
+				result.Unchanged++
+			}
+
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(localPath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %w", rel, err)
+			}
+			result.Files[rel] = info.Mode()
+
+			if remote != nil && remote.Mode()&fs.ModeSymlink != 0 {
+				if current, err := client.ReadLink(remotePath); err == nil && current == target {
+					result.Unchanged++
+					return nil
+				}
+			}
+			if remote != nil {
+				if err := client.RemoveAll(remotePath); err != nil {
+					return fmt.Errorf("failed to replace remote %s: %w", rel, err)
+				}
+			}
+			if err := client.Symlink(target, remotePath); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", rel, err)
+			}
+			result.Updated++
+
+		default:
+			fmt.Printf("Warning: not syncing %s (not a regular file or symlink)\n", rel)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// listRemoteDir returns the entries of a remote directory by name, creating
+// it if it doesn't exist
+func (c *Client) listRemoteDir(remotePath string) (map[string]os.FileInfo, error) {
+	client, err := c.sftpSession()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]os.FileInfo)
+
+	infos, err := client.ReadDir(remotePath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to list remote directory %s: %w", remotePath, err)
+		}
+		if err := client.MkdirAll(remotePath); err != nil {
+			return nil, fmt.Errorf("failed to create remote directory %s: %w", remotePath, err)
+		}
+		return entries, nil
+	}
+
+	for _, info := range infos {
+		entries[info.Name()] = info
+	}
+
+	return entries, nil
+}
+
+// sftpPath converts a shell-style remote path into one SFTP understands.
+// SFTP doesn't expand ~, but relative paths resolve from the home directory.
+func sftpPath(p string) string {
+	if p == "~" {
+		return "."
+	}
+	return strings.TrimPrefix(p, "~/")
+}
+
+// progressReader prints transfer progress as data is read
+type progressReader struct {
+	r       io.Reader
+	name    string
+	total   int64
+	read    int64
+	lastPct int64
+}
+
+func newProgressReader(r io.Reader, total int64, name string) *progressReader {
+	return &progressReader{r: r, name: name, total: total, lastPct: -1}
+}
+
+// Read implements io.Reader
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.read += int64(n)
+
+	pct := p.read * 100 / p.total
+	if pct != p.lastPct {
+		p.lastPct = pct
+		fmt.Printf("\r   %s: %3d%% (%d/%d KB)", p.name, pct, p.read/1024, p.total/1024)
+		if p.read >= p.total {
+			fmt.Println()
+		}
+	}
+
+	return n, err
+}
+
+// ReadFile returns the contents of a remote file
+func (c *Client) ReadFile(remotePath string) ([]byte, error) {
+	client, err := c.sftpSession()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := client.Open(sftpPath(remotePath))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return io.ReadAll(f)
+}
+
+// Remove deletes a remote file
+func (c *Client) Remove(remotePath string) error {
+	client, err := c.sftpSession()
+	if err != nil {
+		return err
+	}
+
+	return client.Remove(sftpPath(remotePath))
+}
@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// ExecuteTerminal runs a command attached to the local terminal, for
+// interactive programs such as shells. If stdin is a terminal, the command
+// gets a pseudo-terminal of the same size, the local terminal is put in raw
+// mode and window size changes are forwarded until the command exits.
+// Otherwise stdin, stdout and stderr are simply connected.
+//
+// A non-zero exit status is returned as a *ssh.ExitError.
+func (c *Client) ExecuteTerminal(command string) error {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("failed to request terminal: %w", err)
+		}
+
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+		}
+		defer func() { _ = term.Restore(fd, oldState) }()
+
+		// Forward window size changes
+		resized := make(chan os.Signal, 1)
+		signal.Notify(resized, syscall.SIGWINCH)
+		defer func() {
+			signal.Stop(resized)
+			close(resized)
+		}()
+		go func() {
+			for range resized {
+				if width, height, err := term.GetSize(fd); err == nil {
+					_ = session.WindowChange(height, width)
+				}
+			}
+		}()
+	}
+
+	if err := session.Run(command); err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
+// ExitStatus returns the exit status of a remote command that failed with a
+// non-zero status
+func ExitStatus(err error) (int, bool) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// Quote quotes s for use as a single word in a POSIX shell command
+func Quote(s string) string {
+	if s != "" && strings.IndexFunc(s, needsQuoting) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuotePath quotes a remote path like Quote, leaving a leading ~ unquoted so
+// the shell still expands it to the home directory
+func QuotePath(p string) string {
+	if p == "~" {
+		return p
+	}
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		return "~/" + Quote(rest)
+	}
+	return Quote(p)
+}
+
+// QuoteArgs quotes each argument and joins them into a shell command line
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// needsQuoting reports whether r has a special meaning to the shell
+func needsQuoting(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("@%_-+=:,./", r)
+}